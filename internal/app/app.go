@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"log"
 	"shario/internal/chat"
+	"shario/internal/config"
 	"shario/internal/identity"
 	"shario/internal/network"
 	"shario/internal/transfer"
@@ -22,6 +23,9 @@ import (
 
 // App represents the main Shario application
 type App struct {
+	// Configuration
+	config *config.Config
+
 	// Core components
 	identity *identity.Manager
 	network  *network.Manager
@@ -39,12 +43,19 @@ type App struct {
 }
 
 // New creates a new Shario application instance
-func New() (*App, error) {
+func New(flags *config.Flags) (*App, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	// Create Fyne application
 	fyneApp := app.New()
 
+	// Load configuration
+	cfg, err := config.Load()
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
 	// Initialize identity manager
 	identityMgr, err := identity.New()
 	if err != nil {
@@ -53,25 +64,28 @@ func New() (*App, error) {
 	}
 
 	// Initialize network manager
-	networkMgr, err := network.New(ctx, identityMgr)
+	networkMgr, err := network.New(ctx, identityMgr, flags.ApplyNetwork(cfg.Network))
 	if err != nil {
 		cancel()
 		return nil, fmt.Errorf("failed to create network manager: %w", err)
 	}
+	saveListenAddrs(cfg, flags, networkMgr)
+	networkMgr.SetVersion(Version)
 
 	// Initialize transfer manager
-	transferMgr := transfer.New(networkMgr)
+	transferMgr := transfer.New(networkMgr, identityMgr, cfg.Transfer)
 
 	// Initialize chat manager
 	chatMgr := chat.New(networkMgr)
 
 	// Initialize UI manager
-	uiMgr := ui.New(fyneApp, identityMgr, networkMgr, transferMgr, chatMgr)
+	uiMgr := ui.New(fyneApp, cfg, identityMgr, networkMgr, transferMgr, chatMgr)
 
 	// Set initial nickname in chat manager
 	chatMgr.SetNickname(identityMgr.GetNickname())
 
 	return &App{
+		config:   cfg,
 		identity: identityMgr,
 		network:  networkMgr,
 		transfer: transferMgr,
@@ -122,9 +136,8 @@ func (a *App) Run() error {
 	a.ui.ShowMainWindow()
 	a.fyneApp.Run()
 
-	// Cleanup
-	a.cancel()
-	a.wg.Wait()
+	// Cleanup once the window is closed
+	a.stop()
 
 	return nil
 }
@@ -174,6 +187,12 @@ func (a *App) RunHeadless() error {
 	return nil
 }
 
+// AcceptInvite validates an invite code and connects to the peer behind it
+func (a *App) AcceptInvite(code string) error {
+	_, err := a.network.AcceptInvite(a.ctx, code)
+	return err
+}
+
 // Shutdown gracefully stops the application
 func (a *App) Shutdown() {
 	a.mu.Lock()
@@ -183,8 +202,8 @@ func (a *App) Shutdown() {
 		return
 	}
 
+	// Run stops the services once the GUI has quit
 	a.isRunning = false
-	a.cancel()
 	a.fyneApp.Quit()
 }
 
@@ -194,11 +213,15 @@ func (a *App) GetStatus() map[string]interface{} {
 	defer a.mu.RUnlock()
 
 	status := map[string]interface{}{
-		"running":    a.isRunning,
-		"peers":      a.network.GetPeerCount(),
-		"identity":   a.identity.GetNickname(),
-		"transfers":  a.transfer.GetActiveTransfers(),
-		"chat_rooms": a.chat.GetActiveRooms(),
+		"running":      a.isRunning,
+		"peers":        a.network.GetPeerCount(),
+		"identity":     a.identity.GetNickname(),
+		"transfers":    a.transfer.GetActiveTransfers(),
+		"chat_rooms":   a.chat.GetActiveRooms(),
+		"reachability": a.network.Reachability(),
+		"network":      a.network.Stats(),
+		"network_mode": a.network.NetworkMode(),
+		"workspaces":   a.network.Workspaces(),
 	}
 
 	return status
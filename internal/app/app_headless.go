@@ -9,14 +9,22 @@ import (
 	"fmt"
 	"log"
 	"shario/internal/chat"
+	"shario/internal/config"
 	"shario/internal/identity"
 	"shario/internal/network"
 	"shario/internal/transfer"
 	"sync"
+	"time"
 )
 
+// headlessInviteTTL is how long the invite code printed at startup stays valid
+const headlessInviteTTL = 24 * time.Hour
+
 // App represents the main Shario application in headless mode
 type App struct {
+	// Configuration
+	config *config.Config
+
 	// Core components (no UI manager)
 	identity *identity.Manager
 	network  *network.Manager
@@ -32,9 +40,16 @@ type App struct {
 }
 
 // New creates a new Shario application instance in headless mode
-func New() (*App, error) {
+func New(flags *config.Flags) (*App, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 
+	// Load configuration
+	cfg, err := config.Load()
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
 	// Initialize identity manager
 	identityMgr, err := identity.New()
 	if err != nil {
@@ -43,20 +58,23 @@ func New() (*App, error) {
 	}
 
 	// Initialize network manager
-	networkMgr, err := network.New(ctx, identityMgr)
+	networkMgr, err := network.New(ctx, identityMgr, flags.ApplyNetwork(cfg.Network))
 	if err != nil {
 		cancel()
 		return nil, fmt.Errorf("failed to create network manager: %w", err)
 	}
+	saveListenAddrs(cfg, flags, networkMgr)
+	networkMgr.SetVersion(Version)
 
 	// Initialize transfer manager
-	transferMgr := transfer.New(networkMgr)
+	transferMgr := transfer.New(networkMgr, identityMgr, cfg.Transfer)
 
 	// Initialize chat manager
 	chatMgr := chat.New(networkMgr)
 
 	// Create application instance
 	app := &App{
+		config:   cfg,
 		identity: identityMgr,
 		network:  networkMgr,
 		transfer: transferMgr,
@@ -113,23 +131,37 @@ func (a *App) RunHeadless() error {
 	log.Printf("Shario headless mode started successfully")
 	log.Printf("Identity: %s", a.identity.GetNickname())
 	log.Printf("Peer ID: %s", a.identity.GetPeerID())
+	if invite, err := a.network.CreateInvite("", headlessInviteTTL); err == nil {
+		log.Printf("Invite code, valid for %d hours: %s", int(headlessInviteTTL.Hours()), invite)
+	}
 	log.Printf("Listening for peers...")
 
 	return nil
 }
 
+// AcceptInvite validates an invite code and connects to the peer behind it
+func (a *App) AcceptInvite(code string) error {
+	_, err := a.network.AcceptInvite(a.ctx, code)
+	return err
+}
+
+// RedeemShareLink requests the file behind a one-time share link
+func (a *App) RedeemShareLink(link string) error {
+	return a.transfer.RedeemShareLink(link)
+}
+
 // Shutdown gracefully stops the application
 func (a *App) Shutdown() {
 	a.mu.Lock()
-	defer a.mu.Unlock()
-
 	if !a.isRunning {
+		a.mu.Unlock()
 		return
 	}
-
 	a.isRunning = false
-	a.cancel()
+	a.mu.Unlock()
+
 	// No GUI to quit in headless mode
+	a.stop()
 }
 
 // GetStatus returns the current application status
@@ -138,11 +170,15 @@ func (a *App) GetStatus() map[string]interface{} {
 	defer a.mu.RUnlock()
 
 	status := map[string]interface{}{
-		"running":    a.isRunning,
-		"peers":      a.network.GetPeerCount(),
-		"identity":   a.identity.GetNickname(),
-		"transfers":  a.transfer.GetActiveTransfers(),
-		"chat_rooms": a.chat.GetActiveRooms(),
+		"running":      a.isRunning,
+		"peers":        a.network.GetPeerCount(),
+		"identity":     a.identity.GetNickname(),
+		"transfers":    a.transfer.GetActiveTransfers(),
+		"chat_rooms":   a.chat.GetActiveRooms(),
+		"reachability": a.network.Reachability(),
+		"network":      a.network.Stats(),
+		"network_mode": a.network.NetworkMode(),
+		"workspaces":   a.network.Workspaces(),
 	}
 
 	return status
@@ -0,0 +1,29 @@
+package app
+
+import (
+	"log"
+	"reflect"
+	"shario/internal/config"
+	"shario/internal/network"
+)
+
+// saveListenAddrs stores randomly assigned listen ports so the node keeps its address across
+// restarts. Saved addresses of disabled transports are dropped, and enabled transports without
+// one get theirs saved.
+func saveListenAddrs(cfg *config.Config, flags *config.Flags, networkMgr *network.Manager) {
+	if flags.OverridesListen() || cfg.Network.Port != 0 {
+		return
+	}
+
+	saved := network.ListenAddrsToSave(cfg.Network, networkMgr.ListenAddrs())
+	if reflect.DeepEqual(saved, cfg.Network.ListenAddrs) {
+		return
+	}
+	cfg.Network.ListenAddrs = saved
+
+	if err := cfg.Save(); err != nil {
+		log.Printf("Failed to save listen addresses: %v", err)
+		return
+	}
+	log.Printf("Saved listen addresses for future runs: %v", cfg.Network.ListenAddrs)
+}
@@ -0,0 +1,49 @@
+package app
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// shutdownTimeout bounds the whole shutdown sequence, a stuck peer cannot keep us running
+const shutdownTimeout = 10 * time.Second
+
+// stop tells peers we are leaving, cancels running transfers and closes the network.
+// Steps still running when the timeout passes are abandoned.
+func (a *App) stop() {
+	log.Printf("👋 Shutting down...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	a.chat.Stop(ctx)
+	a.transfer.Stop(ctx)
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- a.network.Close()
+	}()
+	select {
+	case err := <-closed:
+		if err != nil {
+			log.Printf("Failed to close network manager: %v", err)
+		}
+	case <-ctx.Done():
+		log.Printf("⚠️ Network manager did not close within %s", shutdownTimeout)
+	}
+
+	a.cancel()
+
+	stopped := make(chan struct{})
+	go func() {
+		a.wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		log.Printf("Shutdown complete")
+	case <-ctx.Done():
+		log.Printf("⚠️ Background tasks did not stop within %s", shutdownTimeout)
+	}
+}
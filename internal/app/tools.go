@@ -0,0 +1,42 @@
+package app
+
+import (
+	"fmt"
+	"shario/internal/config"
+	"shario/internal/network"
+)
+
+// RunTools runs a command line tool requested by flags instead of the application.
+// It reports whether a tool ran.
+func RunTools(flags *config.Flags) (bool, error) {
+	switch {
+	case flags.GeneratePSK != "":
+		if err := network.GeneratePSK(flags.GeneratePSK); err != nil {
+			return true, err
+		}
+		return true, printPSK("Generated", flags.GeneratePSK)
+
+	case flags.RotatePSK != "":
+		if err := network.RotatePSK(flags.RotatePSK); err != nil {
+			return true, err
+		}
+		if err := printPSK("Rotated", flags.RotatePSK); err != nil {
+			return true, err
+		}
+		fmt.Println("Copy the new key file to every peer, the previous key was kept as " + flags.RotatePSK + ".prev")
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// printPSK prints the location and fingerprint of a key file
+func printPSK(action, path string) error {
+	psk, err := network.LoadPSK(path)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s pre-shared key %s (fingerprint %s)\n", action, path, network.PSKFingerprint(psk))
+	return nil
+}
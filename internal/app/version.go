@@ -0,0 +1,4 @@
+package app
+
+// Version is the application version announced to peers, set by main before New
+var Version = "dev"
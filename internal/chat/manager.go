@@ -2,15 +2,16 @@
 package chat
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"shario/internal/network"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/libp2p/go-libp2p/core/peer"
-	"github.com/libp2p/go-libp2p/core/protocol"
 )
 
 // Message represents a chat message
@@ -43,6 +44,15 @@ type ChatMessage struct {
 	Data map[string]interface{} `json:"data"`
 }
 
+// workspaceRoomPrefix starts the IDs of the global rooms of workspaces
+const workspaceRoomPrefix = "workspace_"
+
+// chatProtectTag keeps connections to peers we have a direct chat with from being trimmed
+const chatProtectTag = "chat"
+
+// directChatIdle is how long a direct chat keeps its peer protected after the last message
+const directChatIdle = 30 * time.Minute
+
 // Message types
 const (
 	MsgTypeText           = "text"
@@ -51,6 +61,9 @@ const (
 	MsgTypeLeave          = "leave"
 	MsgTypeTyping         = "typing"
 	MsgTypeNicknameChange = "nickname_change"
+
+	// MsgTypeUnsupported answers a message type the receiver does not know, from chat 1.1.0 on
+	MsgTypeUnsupported = "unsupported"
 )
 
 // Manager handles chat functionality
@@ -59,12 +72,20 @@ type Manager struct {
 	rooms   map[string]*Room
 	mutex   sync.RWMutex
 
-	// Global room
-	globalRoom *Room
+	// Global room, the first workspace room when workspaces are joined
+	globalRoom     *Room
+	workspaceRooms map[string]*Room // by workspace name
+
+	// Last message time of the direct chats whose peers are protected from trimming
+	chatActivity map[peer.ID]time.Time
+	protectMutex sync.Mutex
 
 	// Current user info
 	nickname string
 
+	// Network event subscriptions
+	unsubscribes []func()
+
 	// Event handlers
 	onMessageReceived func(*Message)
 	onRoomUpdated     func(*Room)
@@ -74,12 +95,20 @@ type Manager struct {
 // New creates a new chat manager
 func New(networkMgr *network.Manager) *Manager {
 	mgr := &Manager{
-		network: networkMgr,
-		rooms:   make(map[string]*Room),
+		network:        networkMgr,
+		rooms:          make(map[string]*Room),
+		workspaceRooms: make(map[string]*Room),
+		chatActivity:   make(map[peer.ID]time.Time),
 	}
 
-	// Register as network event handler
-	networkMgr.AddEventHandler("chat", mgr)
+	// Subscribe to network events. Chat messages from a peer are handled one at a time, but
+	// each arrives on its own stream, so they may be handled in another order than they were
+	// sent, and independently of the peer's connection events.
+	mgr.unsubscribes = []func(){
+		networkMgr.SubscribePeers(mgr.handlePeerConnected, mgr.handlePeerDisconnected),
+		networkMgr.SubscribePeerUpdated(mgr.handlePeerUpdated),
+		networkMgr.SubscribeMessages(network.ChatProtocol, mgr.handleMessage),
+	}
 
 	return mgr
 }
@@ -126,6 +155,9 @@ func (m *Manager) SendMessage(roomID, content string) error {
 		for peerID := range room.Participants {
 			if peerID != m.network.GetHost().ID() {
 				participantCount++
+				if room.Type == "direct" {
+					m.protectChatPeer(peerID)
+				}
 				log.Printf("📤 Sending message to peer: %s", peerID.String())
 				go m.sendMessageToPeer(peerID, message)
 			}
@@ -172,6 +204,7 @@ func (m *Manager) CreateDirectRoom(peerID peer.ID, peerNickname string) *Room {
 	}
 
 	m.rooms[roomID] = room
+	m.protectChatPeer(peerID)
 
 	// Send join message to peer
 	m.sendJoinMessage(peerID, room)
@@ -335,14 +368,35 @@ func (m *Manager) MarkRoomAsRead(roomID string) {
 	}
 }
 
-// createGlobalRoom creates the global chat room for all users
+// createGlobalRoom creates the global chat room for all users, or one per joined workspace
 func (m *Manager) createGlobalRoom() {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	globalRoom := &Room{
-		ID:   "global",
-		Name: "Global Chat",
+	workspaces := m.network.Workspaces()
+	if len(workspaces) == 0 {
+		m.globalRoom = m.addGlobalRoom("global", "Global Chat",
+			fmt.Sprintf("Welcome to Shario! %s joined the global chat.", m.nickname))
+		log.Printf("Created global chat room")
+		return
+	}
+
+	for _, workspace := range workspaces {
+		room := m.addGlobalRoom(workspaceRoomPrefix+workspace, workspace,
+			fmt.Sprintf("Welcome to the %s workspace! %s joined the chat.", workspace, m.nickname))
+		m.workspaceRooms[workspace] = room
+		if m.globalRoom == nil {
+			m.globalRoom = room
+		}
+	}
+	log.Printf("Created %d workspace chat rooms", len(workspaces))
+}
+
+// addGlobalRoom creates a room every connected member joins. The caller must hold the mutex.
+func (m *Manager) addGlobalRoom(roomID, name, welcome string) *Room {
+	room := &Room{
+		ID:   roomID,
+		Name: name,
 		Type: "global",
 		Participants: map[peer.ID]string{
 			m.network.GetHost().ID(): m.nickname,
@@ -354,62 +408,139 @@ func (m *Manager) createGlobalRoom() {
 	// Add welcome message
 	welcomeMsg := &Message{
 		ID:        fmt.Sprintf("welcome_%d", time.Now().UnixNano()),
-		Content:   fmt.Sprintf("Welcome to Shario! %s joined the global chat.", m.nickname),
+		Content:   welcome,
 		Sender:    "System",
 		SenderID:  "",
 		Timestamp: time.Now(),
-		RoomID:    "global",
+		RoomID:    roomID,
 		Type:      MsgTypeSystem,
 	}
 
-	globalRoom.Messages = append(globalRoom.Messages, welcomeMsg)
-	globalRoom.LastMessage = welcomeMsg
+	room.Messages = append(room.Messages, welcomeMsg)
+	room.LastMessage = welcomeMsg
+
+	m.rooms[roomID] = room
+	return room
+}
+
+// Stop tells connected peers we are leaving and unsubscribes the chat manager from network events.
+// Leave messages still unsent when ctx is done are dropped.
+func (m *Manager) Stop(ctx context.Context) {
+	m.broadcastLeave(ctx)
+
+	for _, unsubscribe := range m.unsubscribes {
+		unsubscribe()
+	}
+}
+
+// broadcastLeave sends a leave message to all connected peers
+func (m *Manager) broadcastLeave(ctx context.Context) {
+	peers := m.network.GetPeers()
+	if len(peers) == 0 {
+		return
+	}
+
+	log.Printf("👋 Telling %d peers we are leaving", len(peers))
+
+	msg := ChatMessage{
+		Type: MsgTypeLeave,
+		Data: map[string]interface{}{
+			"peer_id": m.network.GetHost().ID().String(),
+		},
+	}
 
-	m.rooms["global"] = globalRoom
-	m.globalRoom = globalRoom
+	var wg sync.WaitGroup
+	for _, p := range peers {
+		wg.Add(1)
+		go func(peerID peer.ID) {
+			defer wg.Done()
+			m.sendChatMessage(peerID, msg)
+		}(p.PeerID)
+	}
 
-	log.Printf("Created global chat room")
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Printf("⚠️ Stopped waiting for leave messages: %v", ctx.Err())
+	}
 }
 
-// OnPeerConnected handles peer connection events
-func (m *Manager) OnPeerConnected(peer *network.Peer) {
-	log.Printf("Chat: Peer connected: %s", peer.ID)
+// handlePeerConnected handles peer connection events
+func (m *Manager) handlePeerConnected(event network.PeerConnectedEvent) {
+	log.Printf("Chat: Peer connected: %s", event.Peer.ID)
 
 	// Add peer to global room
-	m.addPeerToGlobalRoom(peer)
+	m.addPeerToGlobalRoom(&event.Peer)
+}
+
+// handlePeerUpdated adds a peer to the workspace rooms its late profile proved membership of
+func (m *Manager) handlePeerUpdated(event network.PeerUpdatedEvent) {
+	m.addPeerToGlobalRoom(&event.Peer)
 }
 
-// addPeerToGlobalRoom adds a newly connected peer to the global room
+// addPeerToGlobalRoom adds a newly connected peer to the global room, or to
+// the rooms of the workspaces it proved membership of
 func (m *Manager) addPeerToGlobalRoom(peer *network.Peer) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	if m.globalRoom == nil {
+	if len(m.workspaceRooms) == 0 {
+		if m.globalRoom != nil {
+			m.addParticipant(m.globalRoom, peer.PeerID, peer.Nickname, "the global chat")
+		}
 		return
 	}
 
-	// Check if peer is already in the global room
-	if _, exists := m.globalRoom.Participants[peer.PeerID]; exists {
-		log.Printf("Peer %s already in global chat, skipping duplicate addition", peer.Nickname)
+	info, exists := m.network.GetPeerInfo(peer.PeerID)
+	if !exists {
+		return
+	}
+	for _, workspace := range info.Workspaces {
+		if room, exists := m.workspaceRooms[workspace]; exists {
+			m.addParticipant(room, info.PeerID, info.Nickname, fmt.Sprintf("the %s workspace", workspace))
+		}
+	}
+}
+
+// isRoomMember reports whether a peer may post to a global room
+func (m *Manager) isRoomMember(room *Room, peerID peer.ID) bool {
+	workspace := strings.TrimPrefix(room.ID, workspaceRoomPrefix)
+	if workspace == room.ID {
+		return true
+	}
+	info, exists := m.network.GetPeerInfo(peerID)
+	return exists && info.InWorkspace(workspace)
+}
+
+// addParticipant adds a peer to a global room and announces it. The caller must hold the mutex.
+func (m *Manager) addParticipant(room *Room, peerID peer.ID, nickname, where string) {
+	// Check if peer is already in the room
+	if _, exists := room.Participants[peerID]; exists {
+		log.Printf("Peer %s already in %s, skipping duplicate addition", nickname, where)
 		return
 	}
 
-	// Add peer to global room participants
-	m.globalRoom.Participants[peer.PeerID] = peer.Nickname
+	// Add peer to room participants
+	room.Participants[peerID] = nickname
 
 	// Add system message about peer joining
 	joinMsg := &Message{
 		ID:        fmt.Sprintf("join_%d", time.Now().UnixNano()),
-		Content:   fmt.Sprintf("%s joined the global chat", peer.Nickname),
+		Content:   fmt.Sprintf("%s joined %s", nickname, where),
 		Sender:    "System",
 		SenderID:  "",
 		Timestamp: time.Now(),
-		RoomID:    "global",
+		RoomID:    room.ID,
 		Type:      MsgTypeSystem,
 	}
 
-	m.globalRoom.Messages = append(m.globalRoom.Messages, joinMsg)
-	m.globalRoom.LastMessage = joinMsg
+	room.Messages = append(room.Messages, joinMsg)
+	room.LastMessage = joinMsg
 
 	// Notify UI to refresh
 	if m.onMessageReceived != nil {
@@ -417,37 +548,85 @@ func (m *Manager) addPeerToGlobalRoom(peer *network.Peer) {
 	}
 
 	if m.onRoomUpdated != nil {
-		go m.onRoomUpdated(m.globalRoom)
+		go m.onRoomUpdated(room)
 	}
 
-	log.Printf("Added peer %s to global chat", peer.Nickname)
+	log.Printf("Added peer %s to %s", nickname, where)
 }
 
-// OnPeerDisconnected handles peer disconnection events
-func (m *Manager) OnPeerDisconnected(peerID peer.ID) {
+// handlePeerDisconnected handles peer disconnection events
+func (m *Manager) handlePeerDisconnected(event network.PeerDisconnectedEvent) {
+	peerID := event.PeerID
+
 	log.Printf("Chat: Peer disconnected: %s", peerID)
 
 	// Add system message to rooms with this peer
-	m.mutex.RLock()
+	m.mutex.Lock()
+	status := "has disconnected"
+	if event.Left {
+		status = "has left"
+	}
 	var affectedRooms []*Room
 	for _, room := range m.rooms {
 		if _, exists := room.Participants[peerID]; exists {
 			affectedRooms = append(affectedRooms, room)
 		}
 	}
-	m.mutex.RUnlock()
+	m.mutex.Unlock()
 
 	for _, room := range affectedRooms {
-		m.addSystemMessage(room, fmt.Sprintf("%s has disconnected", room.Participants[peerID]))
+		m.addSystemMessage(room, fmt.Sprintf("%s %s", room.Participants[peerID], status))
+	}
+
+	m.unprotectChatPeer(peerID)
+}
+
+// protectChatPeer keeps the connections to a direct chat peer from being trimmed until the
+// chat has been idle for directChatIdle
+func (m *Manager) protectChatPeer(peerID peer.ID) {
+	m.protectMutex.Lock()
+	defer m.protectMutex.Unlock()
+
+	_, protected := m.chatActivity[peerID]
+	m.chatActivity[peerID] = time.Now()
+	if !protected {
+		m.network.ProtectPeer(peerID, chatProtectTag)
+		time.AfterFunc(directChatIdle, func() { m.expireChatProtection(peerID) })
 	}
 }
 
-// OnMessage handles incoming messages
-func (m *Manager) OnMessage(peerID peer.ID, protocol protocol.ID, data []byte) {
-	if protocol != network.ChatProtocol {
+// expireChatProtection unprotects a chat peer once its direct chat went idle, or checks again later
+func (m *Manager) expireChatProtection(peerID peer.ID) {
+	m.protectMutex.Lock()
+	defer m.protectMutex.Unlock()
+
+	lastActive, protected := m.chatActivity[peerID]
+	if !protected {
 		return
 	}
+	if idle := time.Since(lastActive); idle < directChatIdle {
+		time.AfterFunc(directChatIdle-idle, func() { m.expireChatProtection(peerID) })
+		return
+	}
+
+	delete(m.chatActivity, peerID)
+	m.network.UnprotectPeer(peerID, chatProtectTag)
+}
 
+// unprotectChatPeer lets the connections to a chat peer be trimmed again
+func (m *Manager) unprotectChatPeer(peerID peer.ID) {
+	m.protectMutex.Lock()
+	defer m.protectMutex.Unlock()
+
+	if _, protected := m.chatActivity[peerID]; protected {
+		delete(m.chatActivity, peerID)
+		m.network.UnprotectPeer(peerID, chatProtectTag)
+	}
+}
+
+// handleMessage handles incoming chat messages
+func (m *Manager) handleMessage(event network.MessageEvent) {
+	peerID, data := event.PeerID, event.Data
 	log.Printf("📥 Received message from peer %s, size: %d bytes", peerID.String(), len(data))
 
 	var msg ChatMessage
@@ -471,9 +650,35 @@ func (m *Manager) OnMessage(peerID peer.ID, protocol protocol.ID, data []byte) {
 		m.handleTypingIndicator(peerID, msg)
 	case MsgTypeNicknameChange:
 		m.handleNicknameChange(peerID, msg)
+	case MsgTypeUnsupported:
+		m.handleUnsupportedMessage(peerID, msg)
 	default:
 		log.Printf("Unknown chat message type: %s", msg.Type)
+		m.replyUnsupported(event, msg.Type)
+	}
+}
+
+// replyUnsupported tells the sender we do not know a message type, when its protocol version
+// understands the reply. Peers on chat 1.0.0 would drop it.
+func (m *Manager) replyUnsupported(event network.MessageEvent, msgType string) {
+	if !network.SupportsReplies(event) {
+		return
 	}
+
+	m.sendChatMessage(event.PeerID, ChatMessage{
+		Type: MsgTypeUnsupported,
+		Data: map[string]interface{}{
+			"type":    msgType,
+			"version": string(event.Version),
+		},
+	})
+}
+
+// handleUnsupportedMessage handles a peer telling us it does not know a message type we sent
+func (m *Manager) handleUnsupportedMessage(peerID peer.ID, msg ChatMessage) {
+	msgType, _ := msg.Data["type"].(string)
+	version, _ := msg.Data["version"].(string)
+	log.Printf("⚠️ Peer %s does not support chat message type %q (speaks %s)", peerID, msgType, version)
 }
 
 // sendMessageToPeer sends a message to a specific peer
@@ -559,6 +764,14 @@ func (m *Manager) handleTextMessage(peerID peer.ID, msg ChatMessage) {
 	room, exists := m.rooms[message.RoomID]
 	m.mutex.RUnlock()
 
+	// Global rooms are never created by peers, workspace rooms only take messages from members
+	if message.RoomID == "global" || strings.HasPrefix(message.RoomID, workspaceRoomPrefix) {
+		if !exists || !m.isRoomMember(room, peerID) {
+			log.Printf("🚫 Dropping message from peer %s to room %s", peerID, message.RoomID)
+			return
+		}
+	}
+
 	if !exists {
 		// Create new room
 		room = &Room{
@@ -577,6 +790,9 @@ func (m *Manager) handleTextMessage(peerID peer.ID, msg ChatMessage) {
 		m.rooms[message.RoomID] = room
 		m.mutex.Unlock()
 	}
+	if room.Type == "direct" {
+		m.protectChatPeer(peerID)
+	}
 
 	// Add message to room
 	room.mutex.Lock()
@@ -651,9 +867,11 @@ func (m *Manager) handleJoinMessage(peerID peer.ID, msg ChatMessage) {
 	}
 }
 
-// handleLeaveMessage handles leave messages
+// handleLeaveMessage remembers that a peer is shutting down, so its disconnect is shown as leaving
 func (m *Manager) handleLeaveMessage(peerID peer.ID, msg ChatMessage) {
-	// TODO: Implement leave message handling
+	log.Printf("👋 Peer %s is leaving", peerID)
+
+	m.network.MarkLeaving(peerID)
 }
 
 // handleTypingIndicator handles typing indicators
@@ -715,44 +933,30 @@ func (m *Manager) handleNicknameChange(peerID peer.ID, msg ChatMessage) {
 	// Update nickname in all rooms for this specific peer
 	m.updatePeerNicknameInRooms(peerID, newNickname)
 
-	// Add system message to global room
-	if m.globalRoom != nil {
-		systemMsg := &Message{
-			ID:        fmt.Sprintf("nick_change_%d", time.Now().UnixNano()),
-			Content:   fmt.Sprintf("%s changed their nickname to %s", oldNickname, newNickname),
-			Sender:    "System",
-			SenderID:  "",
-			Timestamp: time.Now(),
-			RoomID:    "global",
-			Type:      MsgTypeSystem,
-		}
-
-		m.globalRoom.mutex.Lock()
-		m.globalRoom.Messages = append(m.globalRoom.Messages, systemMsg)
-		m.globalRoom.LastMessage = systemMsg
-		m.globalRoom.mutex.Unlock()
-
-		// Notify UI
-		if m.onMessageReceived != nil {
-			go m.onMessageReceived(systemMsg)
+	// Add system message to the rooms the peer is in
+	m.mutex.RLock()
+	var rooms []*Room
+	for _, room := range m.rooms {
+		room.mutex.RLock()
+		if _, exists := room.Participants[peerID]; exists {
+			rooms = append(rooms, room)
 		}
+		room.mutex.RUnlock()
+	}
+	m.mutex.RUnlock()
 
+	for _, room := range rooms {
+		m.addSystemMessage(room, fmt.Sprintf("%s changed their nickname to %s", oldNickname, newNickname))
 		if m.onRoomUpdated != nil {
-			go m.onRoomUpdated(m.globalRoom)
+			go m.onRoomUpdated(room)
 		}
 	}
 }
 
 // updatePeerNickname updates a peer's nickname in the network manager
 func (m *Manager) updatePeerNickname(peerID peer.ID, newNickname string) {
-	peers := m.network.GetPeers()
-	for _, peer := range peers {
-		if peer.PeerID == peerID {
-			peer.Nickname = newNickname
-			log.Printf("Updated peer %s nickname to %s", peerID.String(), newNickname)
-			break
-		}
-	}
+	m.network.SetPeerNickname(peerID, newNickname)
+	log.Printf("Updated peer %s nickname to %s", peerID.String(), newNickname)
 }
 
 // updateNicknameInRooms updates nickname in all rooms where the peer participates
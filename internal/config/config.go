@@ -0,0 +1,240 @@
+// Package config loads and persists user-adjustable application settings
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Config holds all persistent application settings
+type Config struct {
+	Network  NetworkConfig  `json:"network"`
+	Transfer TransferConfig `json:"transfer"`
+
+	path string
+}
+
+// NetworkConfig holds listening and transport settings
+type NetworkConfig struct {
+	// Explicit listen multiaddrs. Addresses of disabled transports are skipped, and
+	// enabled transports without an address listen on Port.
+	ListenAddrs []string `json:"listen_addrs,omitempty"`
+
+	// Extra multiaddrs announced to peers, such as a public IP or a /dns4 name behind port forwarding
+	AnnounceAddrs []string `json:"announce_addrs,omitempty"`
+
+	// Networks in CIDR notation whose addresses are never announced, such as docker bridges or VPN links
+	DenyCIDRs []string `json:"deny_cidrs,omitempty"`
+
+	// Mode is "lan" (mDNS only, nothing reaches beyond the local network),
+	// "internet" (mDNS, DHT and NAT traversal) or "manual" (no discovery)
+	Mode string `json:"mode"`
+
+	// Workspaces to join. Each one is discovered under its own namespace, when
+	// empty every Shario peer on the network is found.
+	Workspaces []WorkspaceConfig `json:"workspaces,omitempty"`
+
+	// Port used for TCP and QUIC, WebSocket uses the next port. Zero picks random
+	// ports on first start, which are then saved to ListenAddrs.
+	Port int `json:"port"`
+
+	// Enabled transports: "tcp", "quic" and "ws". QUIC is opt-in because the
+	// bundled quic-go release panics on inbound handshakes with Go 1.23+ builds.
+	Transports []string `json:"transports"`
+
+	DHT DHTConfig `json:"dht"`
+
+	Relay RelayConfig `json:"relay"`
+
+	Rendezvous RendezvousConfig `json:"rendezvous"`
+
+	PEX PEXConfig `json:"pex"`
+
+	// Pre-shared key file, when set only peers holding the same key can connect
+	PSKFile string `json:"psk_file,omitempty"`
+
+	// AccessMode is "open", "allowlist" or "ask". The lists themselves are kept in access.json.
+	AccessMode string `json:"access_mode"`
+
+	Limits LimitsConfig `json:"limits"`
+}
+
+// WorkspaceConfig names a workspace and optionally the key its members share
+type WorkspaceConfig struct {
+	Name string `json:"name"`
+
+	// Pre-shared key file, when set only peers proving they hold it are shown as members
+	PSKFile string `json:"psk_file,omitempty"`
+}
+
+// DHTConfig holds Kademlia DHT settings
+type DHTConfig struct {
+	// Mode is "auto", "client", "server" or "off". Bootstrap nodes should run as servers.
+	Mode string `json:"mode"`
+
+	// Private uses a Shario-only protocol prefix instead of joining the public IPFS DHT
+	Private bool `json:"private"`
+
+	// Bootstrap peer multiaddrs including /p2p/<peer ID>. When empty the public
+	// DHT uses the default IPFS bootstrap peers and a private DHT uses none.
+	BootstrapPeers []string `json:"bootstrap_peers,omitempty"`
+}
+
+// RelayConfig holds circuit relay settings for peers behind NAT
+type RelayConfig struct {
+	// Relay multiaddrs including /p2p/<peer ID>, used when we are not publicly reachable
+	StaticRelays []string `json:"static_relays,omitempty"`
+
+	// Service runs a circuit relay v2 server for other peers. The node must be
+	// reachable from the internet, so it reports itself as publicly reachable.
+	Service bool `json:"service"`
+}
+
+// RendezvousConfig holds rendezvous point settings, an alternative to DHT discovery
+type RendezvousConfig struct {
+	// Rendezvous point multiaddrs including /p2p/<peer ID>. In internet mode we
+	// register under our namespaces with each of them and search them for peers.
+	Points []string `json:"points,omitempty"`
+
+	// Service answers registrations and searches of other peers
+	Service bool `json:"service"`
+}
+
+// PEXConfig controls peer exchange, where connected Shario peers share the other Shario peers they know
+type PEXConfig struct {
+	// Enabled answers peer exchange requests and, in internet mode, asks connected peers for their peers
+	Enabled bool `json:"enabled"`
+
+	// MaxPeers stops dialing peers learned through peer exchange once this many Shario peers are connected
+	MaxPeers int `json:"max_peers"`
+}
+
+// LimitsConfig caps the resources libp2p may use. Zero keeps the libp2p
+// default, which is scaled to the memory and file descriptors of the machine.
+type LimitsConfig struct {
+	MaxConnections    int `json:"max_connections"`
+	MaxStreamsPerPeer int `json:"max_streams_per_peer"`
+	MaxMemoryMB       int `json:"max_memory_mb"`
+
+	// Connection manager watermarks: above HighWater, the least valuable
+	// connections are closed until LowWater remain. Busy peers are never closed.
+	LowWater  int `json:"low_water"`
+	HighWater int `json:"high_water"`
+}
+
+// TransferConfig holds file transfer settings
+type TransferConfig struct {
+	// Per-peer receive limits, zero disables a limit
+	MaxPendingOffers   int   `json:"max_pending_offers"`
+	MaxOffersPerMinute int   `json:"max_offers_per_minute"`
+	MaxBytesPerDay     int64 `json:"max_bytes_per_day"`
+
+	// File attributes from offers that are applied to received files
+	Metadata MetadataPolicy `json:"metadata"`
+}
+
+// MetadataPolicy selects which file attributes a receiver honors
+type MetadataPolicy struct {
+	ModTime     bool `json:"mod_time"`
+	Permissions bool `json:"permissions"`
+	Executable  bool `json:"executable"`
+}
+
+// Default returns the default configuration
+func Default() *Config {
+	return &Config{
+		Network: NetworkConfig{
+			Mode:       "internet",
+			Port:       0,
+			Transports: []string{"tcp", "ws"},
+			DHT: DHTConfig{
+				Mode: "auto",
+			},
+			AccessMode: "open",
+			PEX: PEXConfig{
+				Enabled:  true,
+				MaxPeers: 50,
+			},
+			Limits: LimitsConfig{
+				MaxConnections:    400,
+				MaxStreamsPerPeer: 512,
+				LowWater:          100,
+				HighWater:         200,
+			},
+		},
+		Transfer: TransferConfig{
+			MaxPendingOffers:   3,
+			MaxOffersPerMinute: 10,
+			MaxBytesPerDay:     10 * 1024 * 1024 * 1024, // 10GB
+			Metadata: MetadataPolicy{
+				ModTime:     true,
+				Permissions: true,
+				Executable:  true,
+			},
+		},
+	}
+}
+
+// Load reads the configuration file, falling back to defaults for missing values
+func Load() (*Config, error) {
+	configDir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+
+	return LoadFile(filepath.Join(configDir, "config.json"))
+}
+
+// LoadFile reads the configuration from a specific file
+func LoadFile(path string) (*Config, error) {
+	cfg := Default()
+	cfg.path = path
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cfg, nil
+		}
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// Save writes the configuration back to the file it was loaded from
+func (c *Config) Save() error {
+	if c.path == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	if err := os.WriteFile(c.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+
+	return nil
+}
+
+// Dir returns the directory holding Shario's configuration and state files
+func Dir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	return filepath.Join(homeDir, ".shario"), nil
+}
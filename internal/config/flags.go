@@ -0,0 +1,149 @@
+package config
+
+import (
+	"flag"
+	"strings"
+)
+
+// Flags holds command line overrides for configuration values.
+// Overrides apply to the current run only and are never saved.
+type Flags struct {
+	Mode              string
+	Workspaces        string
+	Listen            string
+	Announce          string
+	DenyCIDRs         string
+	Port              int
+	Bootstrap         string
+	DHTMode           string
+	PrivateDHT        bool
+	PSK               string
+	AccessMode        string
+	Relays            string
+	RelayService      bool
+	Rendezvous        string
+	RendezvousService bool
+	NoPEX             bool
+
+	// Key tools, which run instead of the application
+	GeneratePSK string
+	RotatePSK   string
+}
+
+// RegisterFlags registers the configuration flags on the default flag set
+func RegisterFlags() *Flags {
+	f := &Flags{}
+	flag.StringVar(&f.Mode, "mode", "", "network mode: lan, internet or manual")
+	flag.StringVar(&f.Workspaces, "workspace", "", "comma-separated workspaces to join, as name or name=key-file")
+	flag.StringVar(&f.Listen, "listen", "", "comma-separated listen multiaddrs, overriding the config file")
+	flag.StringVar(&f.Announce, "announce", "", "comma-separated multiaddrs announced to peers in addition to the listen addresses")
+	flag.StringVar(&f.DenyCIDRs, "deny-cidr", "", "comma-separated networks whose addresses are never announced, e.g. 172.17.0.0/16")
+	flag.IntVar(&f.Port, "port", -1, "port for TCP and QUIC, WebSocket uses the next port (0 picks random ports)")
+	flag.StringVar(&f.Bootstrap, "bootstrap", "", "comma-separated DHT bootstrap peer multiaddrs")
+	flag.StringVar(&f.DHTMode, "dht-mode", "", "DHT mode: auto, client, server or off")
+	flag.BoolVar(&f.PrivateDHT, "private-dht", false, "join the Shario-only DHT instead of the public IPFS DHT")
+	flag.StringVar(&f.PSK, "psk", "", "pre-shared key file restricting connections to a private network")
+	flag.StringVar(&f.Relays, "relay", "", "comma-separated circuit relay multiaddrs used when behind NAT")
+	flag.BoolVar(&f.RelayService, "relay-service", false, "act as a circuit relay server for other peers")
+	flag.StringVar(&f.Rendezvous, "rendezvous", "", "comma-separated rendezvous point multiaddrs used for discovery")
+	flag.BoolVar(&f.RendezvousService, "rendezvous-service", false, "act as a rendezvous point for other peers")
+	flag.BoolVar(&f.NoPEX, "no-pex", false, "do not exchange peer lists with connected peers")
+	flag.StringVar(&f.AccessMode, "access", "", "access mode: open, allowlist or ask")
+	flag.StringVar(&f.GeneratePSK, "gen-psk", "", "generate a new pre-shared key file at the given path and exit")
+	flag.StringVar(&f.RotatePSK, "rotate-psk", "", "replace the pre-shared key file at the given path, keeping the old key as .prev, and exit")
+	return f
+}
+
+// OverridesListen reports whether the listen addresses were set on the command line
+func (f *Flags) OverridesListen() bool {
+	return f != nil && (f.Listen != "" || f.Port >= 0)
+}
+
+// ApplyNetwork returns the network settings with command line overrides applied
+func (f *Flags) ApplyNetwork(cfg NetworkConfig) NetworkConfig {
+	if f == nil {
+		return cfg
+	}
+
+	if f.Mode != "" {
+		cfg.Mode = f.Mode
+	}
+
+	if f.Workspaces != "" {
+		cfg.Workspaces = nil
+		for _, item := range splitList(f.Workspaces) {
+			name, pskFile, _ := strings.Cut(item, "=")
+			cfg.Workspaces = append(cfg.Workspaces, WorkspaceConfig{Name: name, PSKFile: pskFile})
+		}
+	}
+
+	if f.Port >= 0 {
+		cfg.Port = f.Port
+		cfg.ListenAddrs = nil
+	}
+
+	if f.Listen != "" {
+		cfg.ListenAddrs = splitList(f.Listen)
+	}
+
+	if f.Announce != "" {
+		cfg.AnnounceAddrs = splitList(f.Announce)
+	}
+
+	if f.DenyCIDRs != "" {
+		cfg.DenyCIDRs = splitList(f.DenyCIDRs)
+	}
+
+	if f.Bootstrap != "" {
+		cfg.DHT.BootstrapPeers = splitList(f.Bootstrap)
+	}
+
+	if f.DHTMode != "" {
+		cfg.DHT.Mode = f.DHTMode
+	}
+
+	if f.PrivateDHT {
+		cfg.DHT.Private = true
+	}
+
+	if f.PSK != "" {
+		cfg.PSKFile = f.PSK
+	}
+
+	if f.Relays != "" {
+		cfg.Relay.StaticRelays = splitList(f.Relays)
+	}
+
+	if f.RelayService {
+		cfg.Relay.Service = true
+	}
+
+	if f.Rendezvous != "" {
+		cfg.Rendezvous.Points = splitList(f.Rendezvous)
+	}
+
+	if f.RendezvousService {
+		cfg.Rendezvous.Service = true
+	}
+
+	if f.NoPEX {
+		cfg.PEX.Enabled = false
+	}
+
+	if f.AccessMode != "" {
+		cfg.AccessMode = f.AccessMode
+	}
+
+	return cfg
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
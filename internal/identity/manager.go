@@ -53,6 +53,29 @@ func New() (*Manager, error) {
 	return manager, nil
 }
 
+// NewEphemeral creates an in-memory identity that is never written to disk
+func NewEphemeral(nickname string) (*Manager, error) {
+	privateKey, publicKey, err := crypto.GenerateKeyPairWithReader(crypto.Ed25519, -1, rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate keypair: %w", err)
+	}
+
+	peerID, err := peer.IDFromPublicKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate peer ID: %w", err)
+	}
+
+	return &Manager{
+		identity: &Identity{
+			Nickname: nickname,
+			PeerID:   peerID.String(),
+		},
+		privateKey: privateKey,
+		publicKey:  publicKey,
+		peerID:     peerID,
+	}, nil
+}
+
 // loadOrCreateIdentity loads existing identity or creates a new one
 func (m *Manager) loadOrCreateIdentity() error {
 	// Try to load existing identity
@@ -152,6 +175,11 @@ func (m *Manager) createIdentity() error {
 
 // saveIdentity saves identity to file
 func (m *Manager) saveIdentity(identity *Identity) error {
+	// Ephemeral identities have no backing file
+	if m.configPath == "" {
+		return nil
+	}
+
 	// Ensure config directory exists
 	if err := os.MkdirAll(filepath.Dir(m.configPath), 0755); err != nil {
 		return fmt.Errorf("failed to create config directory: %w", err)
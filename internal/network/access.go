@@ -0,0 +1,216 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// AccessList persists the allowed and blocked peers. Entries are peer IDs,
+// IP addresses or CIDR networks.
+type AccessList struct {
+	path    string
+	allowed []string
+	blocked []string
+	mutex   sync.RWMutex
+}
+
+// accessListFile is the on-disk format of an access list
+type accessListFile struct {
+	Allowed []string `json:"allowed"`
+	Blocked []string `json:"blocked"`
+}
+
+// NewAccessList creates an access list backed by the given file, an empty path keeps it in memory
+func NewAccessList(path string) (*AccessList, error) {
+	list := &AccessList{path: path}
+	if path == "" {
+		return list, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return list, nil
+		}
+		return nil, fmt.Errorf("failed to read access list: %w", err)
+	}
+
+	var file accessListFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal access list: %w", err)
+	}
+
+	// Skip entries that no longer parse rather than refusing to start
+	for _, entry := range file.Allowed {
+		if normalized, err := NormalizeAccessEntry(entry); err == nil {
+			list.allowed = appendUnique(list.allowed, normalized)
+		}
+	}
+	for _, entry := range file.Blocked {
+		if normalized, err := NormalizeAccessEntry(entry); err == nil {
+			list.blocked = appendUnique(list.blocked, normalized)
+		}
+	}
+
+	return list, nil
+}
+
+// NormalizeAccessEntry validates a peer ID, IP address or CIDR network and returns its canonical form
+func NormalizeAccessEntry(entry string) (string, error) {
+	entry = strings.TrimSpace(entry)
+
+	if peerID, err := peer.Decode(entry); err == nil {
+		return peerID.String(), nil
+	}
+
+	if ip := net.ParseIP(entry); ip != nil {
+		if ip.To4() != nil {
+			return ip.String() + "/32", nil
+		}
+		return ip.String() + "/128", nil
+	}
+
+	if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+		return ipNet.String(), nil
+	}
+
+	return "", fmt.Errorf("not a peer ID, IP address or CIDR network: %q", entry)
+}
+
+// Allow adds an entry to the allowlist, removing it from the blocklist
+func (l *AccessList) Allow(entry string) error {
+	return l.update(entry, func(normalized string) {
+		l.blocked = remove(l.blocked, normalized)
+		l.allowed = appendUnique(l.allowed, normalized)
+	})
+}
+
+// Block adds an entry to the blocklist, removing it from the allowlist
+func (l *AccessList) Block(entry string) error {
+	return l.update(entry, func(normalized string) {
+		l.allowed = remove(l.allowed, normalized)
+		l.blocked = appendUnique(l.blocked, normalized)
+	})
+}
+
+// Disallow removes an entry from the allowlist
+func (l *AccessList) Disallow(entry string) error {
+	return l.update(entry, func(normalized string) {
+		l.allowed = remove(l.allowed, normalized)
+	})
+}
+
+// Unblock removes an entry from the blocklist
+func (l *AccessList) Unblock(entry string) error {
+	return l.update(entry, func(normalized string) {
+		l.blocked = remove(l.blocked, normalized)
+	})
+}
+
+// Allowed returns a copy of the allowlist
+func (l *AccessList) Allowed() []string {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	return append([]string(nil), l.allowed...)
+}
+
+// Blocked returns a copy of the blocklist
+func (l *AccessList) Blocked() []string {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	return append([]string(nil), l.blocked...)
+}
+
+// IsAllowed reports whether the peer ID or IP address is on the allowlist
+func (l *AccessList) IsAllowed(peerID peer.ID, ip net.IP) bool {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	return matches(l.allowed, peerID, ip)
+}
+
+// IsBlocked reports whether the peer ID or IP address is on the blocklist
+func (l *AccessList) IsBlocked(peerID peer.ID, ip net.IP) bool {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	return matches(l.blocked, peerID, ip)
+}
+
+// update normalizes an entry, applies a change and saves the list
+func (l *AccessList) update(entry string, change func(normalized string)) error {
+	normalized, err := NormalizeAccessEntry(entry)
+	if err != nil {
+		return err
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	change(normalized)
+	return l.save()
+}
+
+// save writes the access list to disk
+func (l *AccessList) save() error {
+	if l.path == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return fmt.Errorf("failed to create access list directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(accessListFile{Allowed: l.allowed, Blocked: l.blocked}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal access list: %w", err)
+	}
+
+	if err := os.WriteFile(l.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write access list: %w", err)
+	}
+
+	return nil
+}
+
+// matches reports whether any normalized entry names the peer or contains the IP address
+func matches(entries []string, peerID peer.ID, ip net.IP) bool {
+	for _, entry := range entries {
+		if peerID != "" && entry == peerID.String() {
+			return true
+		}
+		if ip == nil {
+			continue
+		}
+		if _, ipNet, err := net.ParseCIDR(entry); err == nil && ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// appendUnique appends an entry unless it is already present
+func appendUnique(entries []string, entry string) []string {
+	for _, existing := range entries {
+		if existing == entry {
+			return entries
+		}
+	}
+	return append(entries, entry)
+}
+
+// remove returns the entries without the given one
+func remove(entries []string, entry string) []string {
+	filtered := entries[:0]
+	for _, existing := range entries {
+		if existing != entry {
+			filtered = append(filtered, existing)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,204 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// maxKnownPeerAge is how long a peer that is not a favorite stays in the address book after it was last seen
+const maxKnownPeerAge = 30 * 24 * time.Hour
+
+// KnownPeer is a peer remembered across restarts
+type KnownPeer struct {
+	ID       peer.ID   `json:"id"`
+	Nickname string    `json:"nickname"`
+	Addrs    []string  `json:"addrs"`
+	LastSeen time.Time `json:"last_seen"`
+	Favorite bool      `json:"favorite"`
+}
+
+// AddrInfo returns the peer's last known addresses for dialing
+func (k *KnownPeer) AddrInfo() peer.AddrInfo {
+	info := peer.AddrInfo{ID: k.ID}
+	for _, addrStr := range k.Addrs {
+		if addr, err := multiaddr.NewMultiaddr(addrStr); err == nil {
+			info.Addrs = append(info.Addrs, addr)
+		}
+	}
+	return info
+}
+
+// AddressBook persists known peers with their last addresses, nicknames and last-seen times
+type AddressBook struct {
+	path  string
+	peers map[peer.ID]*KnownPeer
+	mutex sync.RWMutex
+}
+
+// NewAddressBook creates an address book backed by the given file, an empty path keeps it in memory
+func NewAddressBook(path string) (*AddressBook, error) {
+	book := &AddressBook{
+		path:  path,
+		peers: make(map[peer.ID]*KnownPeer),
+	}
+	if path == "" {
+		return book, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return book, nil
+		}
+		return nil, fmt.Errorf("failed to read address book: %w", err)
+	}
+
+	var entries []*KnownPeer
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal address book: %w", err)
+	}
+
+	// Forget peers that have not been seen for a long time
+	for _, entry := range entries {
+		if entry.Favorite || time.Since(entry.LastSeen) < maxKnownPeerAge {
+			book.peers[entry.ID] = entry
+		}
+	}
+
+	return book, nil
+}
+
+// Seen records that a peer is connected on the given addresses
+func (b *AddressBook) Seen(peerID peer.ID, nickname string, addrs []multiaddr.Multiaddr) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	entry, exists := b.peers[peerID]
+	if !exists {
+		entry = &KnownPeer{ID: peerID}
+		b.peers[peerID] = entry
+	}
+
+	if nickname != "" {
+		entry.Nickname = nickname
+	}
+	if len(addrs) > 0 {
+		entry.Addrs = entry.Addrs[:0]
+		for _, addr := range addrs {
+			entry.Addrs = append(entry.Addrs, addr.String())
+		}
+	}
+	entry.LastSeen = time.Now()
+
+	return b.save()
+}
+
+// SetNickname updates the nickname of a known peer
+func (b *AddressBook) SetNickname(peerID peer.ID, nickname string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	entry, exists := b.peers[peerID]
+	if !exists {
+		return nil
+	}
+	entry.Nickname = nickname
+	return b.save()
+}
+
+// SetFavorite marks or unmarks a known peer as favorite
+func (b *AddressBook) SetFavorite(peerID peer.ID, favorite bool) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	entry, exists := b.peers[peerID]
+	if !exists {
+		return fmt.Errorf("unknown peer: %s", peerID)
+	}
+	entry.Favorite = favorite
+	return b.save()
+}
+
+// Forget removes a peer from the address book
+func (b *AddressBook) Forget(peerID peer.ID) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	delete(b.peers, peerID)
+	return b.save()
+}
+
+// Get returns a copy of a known peer
+func (b *AddressBook) Get(peerID peer.ID) (KnownPeer, bool) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	entry, exists := b.peers[peerID]
+	if !exists {
+		return KnownPeer{}, false
+	}
+	return entry.copy(), true
+}
+
+// Peers returns copies of all known peers, favorites first and then by last seen
+func (b *AddressBook) Peers() []KnownPeer {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	peers := make([]KnownPeer, 0, len(b.peers))
+	for _, entry := range b.peers {
+		peers = append(peers, entry.copy())
+	}
+
+	sort.Slice(peers, func(i, j int) bool {
+		if peers[i].Favorite != peers[j].Favorite {
+			return peers[i].Favorite
+		}
+		return peers[i].LastSeen.After(peers[j].LastSeen)
+	})
+
+	return peers
+}
+
+// copy returns a copy that does not share the address slice
+func (k *KnownPeer) copy() KnownPeer {
+	c := *k
+	c.Addrs = append([]string(nil), k.Addrs...)
+	return c
+}
+
+// save writes the address book to disk
+func (b *AddressBook) save() error {
+	if b.path == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(b.path), 0755); err != nil {
+		return fmt.Errorf("failed to create address book directory: %w", err)
+	}
+
+	entries := make([]*KnownPeer, 0, len(b.peers))
+	for _, entry := range b.peers {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal address book: %w", err)
+	}
+
+	if err := os.WriteFile(b.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write address book: %w", err)
+	}
+
+	return nil
+}
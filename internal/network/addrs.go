@@ -0,0 +1,273 @@
+package network
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"shario/internal/config"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/p2p/transport/tcp"
+	"github.com/libp2p/go-libp2p/p2p/transport/websocket"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+
+	libp2pquic "github.com/libp2p/go-libp2p/p2p/transport/quic"
+)
+
+// Transport names accepted in the network configuration
+const (
+	TransportTCP       = "tcp"
+	TransportQUIC      = "quic"
+	TransportWebSocket = "ws"
+)
+
+// listenAddrsFromConfig returns the configured listen addresses of enabled transports, and
+// builds addresses from the port for every enabled transport without one
+func listenAddrsFromConfig(cfg config.NetworkConfig) ([]multiaddr.Multiaddr, error) {
+	var addrs []multiaddr.Multiaddr
+	covered := make(map[string]bool)
+	for _, addrStr := range cfg.ListenAddrs {
+		addr, err := multiaddr.NewMultiaddr(addrStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid listen address %q: %w", addrStr, err)
+		}
+		transport := listenTransport(addr)
+		if !hasTransport(cfg.Transports, transport) {
+			log.Printf("⚠️ Not listening on %s, its transport is not enabled", addr)
+			continue
+		}
+		covered[transport] = true
+		addrs = append(addrs, addr)
+	}
+
+	var missing []string
+	for _, transport := range cfg.Transports {
+		if !covered[transport] {
+			missing = append(missing, transport)
+		}
+	}
+	if len(missing) == 0 {
+		return addrs, nil
+	}
+
+	if cfg.Port < 0 || cfg.Port > 65534 {
+		return nil, fmt.Errorf("invalid listen port: %d", cfg.Port)
+	}
+
+	// WebSocket cannot share the TCP port, so it takes the next one
+	wsPort := 0
+	if cfg.Port != 0 {
+		wsPort = cfg.Port + 1
+	}
+
+	for _, ip := range []string{"/ip4/0.0.0.0", "/ip6/::"} {
+		for _, transport := range missing {
+			switch transport {
+			case TransportTCP:
+				addrs = append(addrs, multiaddr.StringCast(fmt.Sprintf("%s/tcp/%d", ip, cfg.Port)))
+			case TransportQUIC:
+				addrs = append(addrs, multiaddr.StringCast(fmt.Sprintf("%s/udp/%d/quic-v1", ip, cfg.Port)))
+			case TransportWebSocket:
+				addrs = append(addrs, multiaddr.StringCast(fmt.Sprintf("%s/tcp/%d/ws", ip, wsPort)))
+			}
+		}
+	}
+
+	return addrs, nil
+}
+
+// ListenAddrsToSave returns the listen addresses to keep in the configuration: the configured
+// addresses of enabled transports, followed by the bound addresses of enabled transports the
+// configuration had none for
+func ListenAddrsToSave(cfg config.NetworkConfig, bound []multiaddr.Multiaddr) []string {
+	var saved []string
+	covered := make(map[string]bool)
+	for _, addrStr := range cfg.ListenAddrs {
+		addr, err := multiaddr.NewMultiaddr(addrStr)
+		if err != nil {
+			continue
+		}
+		transport := listenTransport(addr)
+		if hasTransport(cfg.Transports, transport) {
+			covered[transport] = true
+			saved = append(saved, addrStr)
+		}
+	}
+
+	for _, addr := range bound {
+		transport := listenTransport(addr)
+		if transport == "" || covered[transport] || !hasTransport(cfg.Transports, transport) {
+			continue
+		}
+		// Relay addresses are not bound locally
+		if _, err := addr.ValueForProtocol(multiaddr.P_CIRCUIT); err == nil {
+			continue
+		}
+		saved = append(saved, addr.String())
+	}
+
+	return saved
+}
+
+// listenTransport returns the configuration name of the transport listening on an address,
+// or an empty string when none of ours does
+func listenTransport(addr multiaddr.Multiaddr) string {
+	if _, err := addr.ValueForProtocol(multiaddr.P_WS); err == nil {
+		return TransportWebSocket
+	}
+	if _, err := addr.ValueForProtocol(multiaddr.P_QUIC_V1); err == nil {
+		return TransportQUIC
+	}
+	if _, err := addr.ValueForProtocol(multiaddr.P_TCP); err == nil {
+		return TransportTCP
+	}
+	return ""
+}
+
+// hasTransport reports whether the named transport is in the list
+func hasTransport(transports []string, name string) bool {
+	for _, transport := range transports {
+		if transport == name {
+			return true
+		}
+	}
+	return false
+}
+
+// shareableAddr reports whether an address is worth telling other machines about,
+// leaving out loopback, unspecified and link-local addresses no other machine can dial
+func shareableAddr(addr multiaddr.Multiaddr) bool {
+	return !manet.IsIPLoopback(addr) && !manet.IsIPUnspecified(addr) && !manet.IsIP6LinkLocal(addr)
+}
+
+// lanAddrs returns the private and loopback addresses, leaving out public, DNS and relayed ones
+func lanAddrs(addrs []multiaddr.Multiaddr) []multiaddr.Multiaddr {
+	var lan []multiaddr.Multiaddr
+	for _, addr := range addrs {
+		if manet.IsPrivateAddr(addr) && !isRelayedAddr(addr) {
+			lan = append(lan, addr)
+		}
+	}
+	return lan
+}
+
+// addrsFactory returns the address factory deciding which of our addresses peers learn about.
+// Addresses in denied networks are dropped, as are loopback and link-local addresses unless
+// nothing else is left, and the configured announce addresses are added.
+func addrsFactory(cfg config.NetworkConfig) (func([]multiaddr.Multiaddr) []multiaddr.Multiaddr, error) {
+	var denied []*net.IPNet
+	for _, cidr := range cfg.DenyCIDRs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid denied network %q: %w", cidr, err)
+		}
+		denied = append(denied, ipNet)
+	}
+
+	var announce []multiaddr.Multiaddr
+	for _, addrStr := range cfg.AnnounceAddrs {
+		addr, err := multiaddr.NewMultiaddr(addrStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid announce address %q: %w", addrStr, err)
+		}
+		announce = append(announce, addr)
+	}
+
+	if len(announce) > 0 {
+		log.Printf("🌐 Announcing %v in addition to our listen addresses", announce)
+	}
+	if len(denied) > 0 {
+		log.Printf("🌐 Not announcing addresses in %v", denied)
+	}
+
+	return func(addrs []multiaddr.Multiaddr) []multiaddr.Multiaddr {
+		var allowed, local []multiaddr.Multiaddr
+		for _, addr := range addrs {
+			if ip := addrIP(addr); ip != nil && inNetworks(ip, denied) {
+				continue
+			}
+			if shareableAddr(addr) {
+				allowed = append(allowed, addr)
+			} else {
+				local = append(local, addr)
+			}
+		}
+
+		// Keep loopback addresses when they are all we have, so instances on one machine still connect
+		if len(allowed) == 0 && len(announce) == 0 {
+			allowed = local
+		}
+
+		for _, addr := range announce {
+			if !multiaddr.Contains(allowed, addr) {
+				allowed = append(allowed, addr)
+			}
+		}
+		return allowed
+	}, nil
+}
+
+// inNetworks reports whether an IP address lies in one of the networks
+func inNetworks(ip net.IP, networks []*net.IPNet) bool {
+	for _, ipNet := range networks {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// transportOptions returns the libp2p options enabling the configured transports
+func transportOptions(transports []string) ([]libp2p.Option, error) {
+	if len(transports) == 0 {
+		return nil, fmt.Errorf("no transports enabled")
+	}
+
+	var opts []libp2p.Option
+	for _, transport := range transports {
+		switch transport {
+		case TransportTCP:
+			opts = append(opts, libp2p.Transport(tcp.NewTCPTransport))
+		case TransportQUIC:
+			opts = append(opts, libp2p.Transport(libp2pquic.NewTransport))
+		case TransportWebSocket:
+			opts = append(opts, libp2p.Transport(websocket.New))
+		default:
+			return nil, fmt.Errorf("unknown transport: %s", transport)
+		}
+	}
+
+	return opts, nil
+}
+
+// withoutTransport returns the transport list without the named transport
+func withoutTransport(transports []string, name string) []string {
+	filtered := make([]string, 0, len(transports))
+	for _, transport := range transports {
+		if transport != name {
+			filtered = append(filtered, transport)
+		}
+	}
+	return filtered
+}
+
+// withRandomPorts returns copies of the addresses with every TCP and UDP port set to zero
+func withRandomPorts(addrs []multiaddr.Multiaddr) []multiaddr.Multiaddr {
+	randomized := make([]multiaddr.Multiaddr, 0, len(addrs))
+	for _, addr := range addrs {
+		var parts []multiaddr.Multiaddr
+		for _, part := range multiaddr.Split(addr) {
+			switch part.Protocols()[0].Code {
+			case multiaddr.P_TCP:
+				part = multiaddr.StringCast("/tcp/0")
+			case multiaddr.P_UDP:
+				part = multiaddr.StringCast("/udp/0")
+			}
+			parts = append(parts, part)
+		}
+		randomized = append(randomized, multiaddr.Join(parts...))
+	}
+
+	return randomized
+}
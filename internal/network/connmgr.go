@@ -0,0 +1,96 @@
+package network
+
+import (
+	"fmt"
+	"log"
+	"shario/internal/config"
+	"time"
+
+	coreconnmgr "github.com/libp2p/go-libp2p/core/connmgr"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/net/connmgr"
+)
+
+// Connection manager settings
+const (
+	connGracePeriod  = time.Minute // new connections are never trimmed before this
+	sharioPeerTag    = "shario"    // tag preferring Shario peers over other nodes when trimming
+	sharioPeerWeight = 50
+)
+
+// connManager creates a connection manager trimming connections down to the low
+// watermark once the high watermark is exceeded. A zero high watermark disables trimming.
+func connManager(cfg config.LimitsConfig) (coreconnmgr.ConnManager, error) {
+	if cfg.HighWater <= 0 {
+		return &coreconnmgr.NullConnMgr{}, nil
+	}
+
+	cm, err := connmgr.NewConnManager(cfg.LowWater, cfg.HighWater, connmgr.WithGracePeriod(connGracePeriod))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create connection manager: %w", err)
+	}
+	return cm, nil
+}
+
+// ProtectPeer keeps the connections to a peer from being trimmed until the tag is unprotected
+func (m *Manager) ProtectPeer(peerID peer.ID, tag string) {
+	m.host.ConnManager().Protect(peerID, tag)
+}
+
+// UnprotectPeer removes a protection tag, the peer may be trimmed once no tag protects it
+func (m *Manager) UnprotectPeer(peerID peer.ID, tag string) {
+	m.host.ConnManager().Unprotect(peerID, tag)
+}
+
+// isSharioPeer reports whether identify showed that a peer speaks one of our protocols
+func (m *Manager) isSharioPeer(peerID peer.ID) bool {
+	protocols, err := m.host.Peerstore().SupportsProtocols(peerID, HelloProtocol, ChatProtocol, TransferProtocol)
+	return err == nil && len(protocols) > 0
+}
+
+// admitPeer adds a connected Shario peer to the peer list, exchanges profiles and then notifies handlers.
+// Other nodes, such as DHT servers, stay connected but are never listed.
+func (m *Manager) admitPeer(peerID peer.ID) {
+	conns := m.host.Network().ConnsToPeer(peerID)
+	if len(conns) == 0 || m.holdBack(peerID) {
+		return
+	}
+
+	// Start with the nickname we knew the peer by, the hello exchange updates it
+	nickname := defaultNickname(peerID)
+	if known, exists := m.addressBook.Get(peerID); exists && known.Nickname != "" {
+		nickname = known.Nickname
+	}
+	p := &Peer{
+		ID:          peerID.String(),
+		Nickname:    nickname,
+		ConnectedAt: time.Now(),
+		PeerID:      peerID,
+	}
+	for _, conn := range conns {
+		p.Addresses = append(p.Addresses, conn.RemoteMultiaddr())
+	}
+
+	m.peersMutex.Lock()
+	if _, exists := m.peers[peerID]; exists {
+		m.peersMutex.Unlock()
+		return
+	}
+	m.peerEntries++
+	p.generation = m.peerEntries
+	m.peers[peerID] = p
+	totalPeers := len(m.peers)
+	m.peersMutex.Unlock()
+
+	// Register before greeting so an early profile from the peer is not missed
+	received := make(chan struct{})
+	m.profileMutex.Lock()
+	m.hellos[peerID] = received
+	m.profileMutex.Unlock()
+
+	m.host.ConnManager().TagPeer(peerID, sharioPeerTag, sharioPeerWeight)
+	log.Printf("🔗 Shario peer %s added, total peers: %d", peerID, totalPeers)
+
+	go m.greet(peerID, p.generation, received)
+	go m.measurePeer(peerID)
+}
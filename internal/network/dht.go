@@ -0,0 +1,252 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"shario/internal/config"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p-kad-dht"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/p2p/discovery/routing"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// PrivateDHTPrefix is the protocol prefix of the Shario-only DHT
+const PrivateDHTPrefix = protocol.ID("/shario")
+
+// DHT modes accepted in the network configuration
+const (
+	DHTModeAuto   = "auto"
+	DHTModeClient = "client"
+	DHTModeServer = "server"
+	DHTModeOff    = "off" // no DHT, for example when rendezvous points are used instead
+)
+
+// dhtOptions converts the DHT configuration into DHT options and resolved bootstrap peers
+func dhtOptions(cfg config.DHTConfig) ([]dht.Option, []peer.AddrInfo, error) {
+	var opts []dht.Option
+
+	switch cfg.Mode {
+	case "", DHTModeAuto:
+		opts = append(opts, dht.Mode(dht.ModeAuto))
+	case DHTModeClient:
+		opts = append(opts, dht.Mode(dht.ModeClient))
+	case DHTModeServer:
+		opts = append(opts, dht.Mode(dht.ModeServer))
+	case DHTModeOff:
+		return nil, nil, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown DHT mode: %s", cfg.Mode)
+	}
+
+	if cfg.Private {
+		opts = append(opts, dht.ProtocolPrefix(PrivateDHTPrefix))
+	}
+
+	bootstrapPeers, err := parsePeerAddrs("bootstrap", cfg.BootstrapPeers)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(bootstrapPeers) == 0 && !cfg.Private {
+		bootstrapPeers = dht.GetDefaultBootstrapPeerAddrInfos()
+	}
+
+	// The DHT reconnects to these peers whenever its routing table runs empty
+	opts = append(opts, dht.BootstrapPeers(bootstrapPeers...))
+
+	return opts, bootstrapPeers, nil
+}
+
+// dhtProtocol returns the protocol the DHT configuration speaks
+func dhtProtocol(cfg config.DHTConfig) protocol.ID {
+	if cfg.Private {
+		return PrivateDHTPrefix + "/kad/1.0.0"
+	}
+	return dht.ProtocolDHT
+}
+
+// parsePeerAddrs parses bootstrap or relay multiaddrs, merging addresses of the same peer
+func parsePeerAddrs(kind string, addrStrs []string) ([]peer.AddrInfo, error) {
+	addrs := make([]multiaddr.Multiaddr, 0, len(addrStrs))
+	for _, addrStr := range addrStrs {
+		addr, err := multiaddr.NewMultiaddr(addrStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s address %q: %w", kind, addrStr, err)
+		}
+		addrs = append(addrs, addr)
+	}
+
+	infos, err := peer.AddrInfosFromP2pAddrs(addrs...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s peer: %w", kind, err)
+	}
+
+	return infos, nil
+}
+
+// connectBootstrapPeers dials all bootstrap peers in parallel and reports how many answered
+func (m *Manager) connectBootstrapPeers(ctx context.Context) {
+	if len(m.bootstrapPeers) == 0 {
+		log.Printf("No DHT bootstrap peers configured, waiting for peers to connect")
+		return
+	}
+
+	var wg sync.WaitGroup
+	var connected int
+	var mu sync.Mutex
+
+	for _, info := range m.bootstrapPeers {
+		if info.ID == m.host.ID() {
+			continue
+		}
+
+		wg.Add(1)
+		go func(info peer.AddrInfo) {
+			defer wg.Done()
+
+			dialCtx, cancel := context.WithTimeout(ctx, ConnectionTimeout)
+			defer cancel()
+
+			if err := m.Connect(dialCtx, info); err != nil {
+				log.Printf("Failed to connect to bootstrap peer %s: %v", info.ID, err)
+				return
+			}
+
+			mu.Lock()
+			connected++
+			mu.Unlock()
+		}(info)
+	}
+
+	wg.Wait()
+	log.Printf("Connected to %d of %d DHT bootstrap peers", connected, len(m.bootstrapPeers))
+}
+
+// Timing of DHT discovery
+const (
+	dhtDiscoveryInterval = 5 * time.Second
+	dhtAnnounceInterval  = 10 * time.Second
+)
+
+// dhtDiscoverer finds peers through the Kademlia DHT. The DHT is created when
+// discovery starts and closed when it stops.
+type dhtDiscoverer struct {
+	manager *Manager
+	dht     *dht.IpfsDHT
+}
+
+// Name identifies the backend in logs
+func (d *dhtDiscoverer) Name() string {
+	return "DHT"
+}
+
+// Start creates and bootstraps the DHT, then searches and announces the namespaces
+func (d *dhtDiscoverer) Start(ctx context.Context, namespaces []string, found func(peer.AddrInfo)) error {
+	m := d.manager
+	kademliaDHT, err := dht.New(ctx, m.host, m.dhtOpts...)
+	if err != nil {
+		return fmt.Errorf("failed to create DHT: %w", err)
+	}
+
+	if err := kademliaDHT.Bootstrap(ctx); err != nil {
+		kademliaDHT.Close()
+		return fmt.Errorf("failed to bootstrap DHT: %w", err)
+	}
+	d.dht = kademliaDHT
+
+	routingDisc := routing.NewRoutingDiscovery(kademliaDHT)
+	go m.connectBootstrapPeers(ctx)
+	go d.discover(ctx, routingDisc, namespaces, found)
+	go d.announce(ctx, routingDisc, namespaces)
+
+	return nil
+}
+
+// discover periodically looks up the peers announced under the namespaces
+func (d *dhtDiscoverer) discover(ctx context.Context, routingDisc *routing.RoutingDiscovery, namespaces []string, found func(peer.AddrInfo)) {
+	log.Println("Starting DHT discovery...")
+
+	// Initial discovery attempt
+	go func() {
+		for _, namespace := range namespaces {
+			if _, err := routingDisc.Advertise(ctx, namespace); err != nil {
+				log.Printf("DHT advertising not available yet: %v (this is normal for the first instance)", err)
+			} else {
+				log.Printf("Successfully advertised service '%s' on DHT", namespace)
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(dhtDiscoveryInterval)
+	defer ticker.Stop()
+
+	discoveryCount := 0
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			discoveryCount++
+			log.Printf("DHT discovery attempt #%d", discoveryCount)
+
+			for _, namespace := range namespaces {
+				peerChan, err := routingDisc.FindPeers(ctx, namespace)
+				if err != nil {
+					log.Printf("Failed to find peers via DHT: %v", err)
+					continue
+				}
+
+				go func(attempt int) {
+					peersFound := 0
+					for peerInfo := range peerChan {
+						if peerInfo.ID == d.manager.host.ID() {
+							continue
+						}
+						peersFound++
+						found(peerInfo)
+					}
+
+					if peersFound == 0 {
+						log.Printf("No peers found via DHT in attempt #%d", attempt)
+					}
+				}(discoveryCount)
+			}
+		}
+	}
+}
+
+// announce periodically announces our presence under the namespaces
+func (d *dhtDiscoverer) announce(ctx context.Context, routingDisc *routing.RoutingDiscovery, namespaces []string) {
+	ticker := time.NewTicker(dhtAnnounceInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, namespace := range namespaces {
+				if _, err := routingDisc.Advertise(ctx, namespace); err != nil {
+					// Only log this if we have peers in the DHT table
+					if d.dht.RoutingTable().Size() > 0 {
+						log.Printf("Failed to advertise presence: %v", err)
+					}
+				}
+			}
+		}
+	}
+}
+
+// Close removes the DHT stream handler, which closing the DHT leaves in place, and closes the DHT
+func (d *dhtDiscoverer) Close() error {
+	if d.dht == nil {
+		return nil
+	}
+	d.manager.host.RemoveStreamHandler(d.manager.dhtProtocol)
+	return d.dht.Close()
+}
@@ -0,0 +1,173 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/discovery/mdns"
+)
+
+// Discoverer is a peer discovery backend. mDNS, the DHT, rendezvous points and peer
+// exchange implement it, other backends can be added with AddDiscoverer.
+type Discoverer interface {
+	// Name identifies the backend in logs
+	Name() string
+
+	// Start announces us under the namespaces and reports the peers it finds until ctx is done
+	Start(ctx context.Context, namespaces []string, found func(peer.AddrInfo)) error
+
+	// Close releases the resources of a started backend after its context is done
+	Close() error
+}
+
+// AddDiscoverer adds a discovery backend that runs alongside the built-in ones in every mode except manual
+func (m *Manager) AddDiscoverer(d Discoverer) {
+	m.modeMutex.Lock()
+	defer m.modeMutex.Unlock()
+
+	m.customDiscoverers = append(m.customDiscoverers, d)
+	if m.discoveryCancel != nil && m.mode != ModeManual {
+		m.startDiscoverer(d)
+	}
+}
+
+// discoverersFor returns the discovery backends of a network mode
+func (m *Manager) discoverersFor(mode string) []Discoverer {
+	if mode == ModeManual {
+		return nil
+	}
+	if !m.builtinDiscovery {
+		return m.customDiscoverers
+	}
+
+	var discoverers []Discoverer
+	switch mode {
+	case ModeLAN:
+		discoverers = append(discoverers, &mdnsDiscoverer{manager: m})
+	case ModeInternet:
+		discoverers = append(discoverers, &mdnsDiscoverer{manager: m})
+		if m.dhtEnabled {
+			discoverers = append(discoverers, &dhtDiscoverer{manager: m})
+		}
+		if len(m.rendezvousPoints) > 0 {
+			discoverers = append(discoverers, &rendezvousDiscoverer{manager: m, points: m.rendezvousPoints})
+		}
+		if m.pexEnabled {
+			discoverers = append(discoverers, &pexDiscoverer{manager: m})
+		}
+	}
+	return append(discoverers, m.customDiscoverers...)
+}
+
+// startDiscoverer starts a backend with the running discovery context.
+// The caller must hold modeMutex.
+func (m *Manager) startDiscoverer(d Discoverer) {
+	ctx := m.discoveryCtx
+	found := func(info peer.AddrInfo) {
+		m.handlePeerFound(ctx, d.Name(), info)
+	}
+
+	if err := d.Start(ctx, m.namespaces(), found); err != nil {
+		log.Printf("⚠️ Failed to start %s discovery: %v", d.Name(), err)
+		return
+	}
+	m.discoverers = append(m.discoverers, d)
+}
+
+// handlePeerFound connects to a peer reported by a discovery backend
+func (m *Manager) handlePeerFound(ctx context.Context, source string, info peer.AddrInfo) {
+	// Don't connect to ourselves or to peers we are already connected to
+	if info.ID == m.host.ID() || m.host.Network().Connectedness(info.ID) == network.Connected {
+		return
+	}
+
+	// Redialing a peer we already asked about would only be refused again
+	if m.gater.pending(info.ID) {
+		return
+	}
+
+	log.Printf("🔍 %s discovery: found peer %s", source, info.ID)
+	log.Printf("  Peer addresses: %v", info.Addrs)
+
+	if err := m.Connect(ctx, info); err != nil {
+		log.Printf("  ❌ Failed to connect to discovered peer %s: %v", info.ID, err)
+	} else {
+		log.Printf("  ✅ Successfully connected to peer %s via %s", info.ID, source)
+	}
+}
+
+// mdnsDiscoverer finds peers on the local network, with one mDNS service per namespace
+type mdnsDiscoverer struct {
+	manager  *Manager
+	services []mdns.Service
+}
+
+// mdnsNotifiee passes peers found by an mDNS service on to the manager
+type mdnsNotifiee func(peer.AddrInfo)
+
+// HandlePeerFound is called when a peer is discovered via mDNS
+func (found mdnsNotifiee) HandlePeerFound(info peer.AddrInfo) {
+	found(info)
+}
+
+// Name identifies the backend in logs
+func (d *mdnsDiscoverer) Name() string {
+	return "mDNS"
+}
+
+// Start announces every namespace as an mDNS service tag
+func (d *mdnsDiscoverer) Start(ctx context.Context, namespaces []string, found func(peer.AddrInfo)) error {
+	m := d.manager
+	log.Printf("Host ID: %s", m.host.ID().String())
+	log.Printf("Host addresses:")
+	for _, addr := range m.host.Addrs() {
+		log.Printf("  %s", addr.String())
+	}
+
+	for _, namespace := range namespaces {
+		log.Printf("Starting mDNS discovery with service tag: '%s'", namespace)
+		service := mdns.NewMdnsService(m.host, namespace, mdnsNotifiee(found))
+		if err := service.Start(); err != nil {
+			d.Close()
+			return fmt.Errorf("failed to start mDNS service %s: %w", namespace, err)
+		}
+		d.services = append(d.services, service)
+	}
+	log.Printf("mDNS discovery service started successfully")
+
+	// Add periodic check to see if mDNS is working
+	go func() {
+		ticker := time.NewTicker(15 * time.Second)
+		defer ticker.Stop()
+		checks := 0
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				checks++
+				peerCount := m.GetPeerCount()
+				log.Printf("mDNS check #%d: %d peers discovered so far", checks, peerCount)
+				if checks >= 4 && peerCount == 0 {
+					log.Printf("Warning: No peers discovered after %d seconds. Try manual connection.", checks*15)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Close stops the mDNS services
+func (d *mdnsDiscoverer) Close() error {
+	for _, service := range d.services {
+		service.Close()
+	}
+	d.services = nil
+	return nil
+}
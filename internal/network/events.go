@@ -0,0 +1,250 @@
+package network
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// Event queue limits
+const (
+	eventQueueSize    = 256         // events buffered per peer and protocol before publishers block
+	eventQueueIdleTTL = time.Minute // idle queue workers exit after this long
+)
+
+// PeerConnectedEvent is published when the first connection to a peer opens. Peer is a
+// copy taken once the peer's profile arrived, later changes are published as PeerUpdatedEvent.
+type PeerConnectedEvent struct {
+	Peer Peer
+}
+
+// PeerUpdatedEvent is published when a profile arrives from a peer that was already announced,
+// such as one whose hello came late. Peer is a copy taken once the profile was applied.
+type PeerUpdatedEvent struct {
+	Peer Peer
+}
+
+// PeerDisconnectedEvent is published when the last connection to a peer closes
+type PeerDisconnectedEvent struct {
+	PeerID peer.ID
+	Left   bool // the peer said it was shutting down before the connection closed
+}
+
+// MessageEvent is published for every protocol message received from a peer
+type MessageEvent struct {
+	PeerID   peer.ID
+	Protocol protocol.ID
+	Version  protocol.ID // protocol version the message arrived on
+	Data     []byte
+}
+
+// eventKey selects the queue an event is delivered through. Events with the
+// same key reach a subscriber one at a time and in the order they were published.
+type eventKey struct {
+	peer     peer.ID
+	protocol protocol.ID // empty for peer connection events
+}
+
+// eventBus dispatches events to subscribers through bounded, ordered queues
+type eventBus struct {
+	ctx         context.Context
+	subscribers map[int]*subscriber
+	nextID      int
+	mutex       sync.RWMutex
+}
+
+// subscriber holds one subscription and its queues, each served by its own worker
+type subscriber struct {
+	accepts func(event interface{}) bool
+	handle  func(event interface{})
+	queues  map[eventKey]*eventQueue
+	done    chan struct{}
+	mutex   sync.Mutex
+}
+
+// eventQueue buffers the events of one key for a subscriber
+type eventQueue struct {
+	events  chan interface{}
+	pending int // events published but not yet handled, guarded by the subscriber mutex
+}
+
+// newEventBus creates an event bus whose workers stop with the context
+func newEventBus(ctx context.Context) *eventBus {
+	return &eventBus{
+		ctx:         ctx,
+		subscribers: make(map[int]*subscriber),
+	}
+}
+
+// subscribe registers a handler for the events it accepts and returns a func that unsubscribes
+func (b *eventBus) subscribe(accepts func(event interface{}) bool, handle func(event interface{})) func() {
+	sub := &subscriber{
+		accepts: accepts,
+		handle:  handle,
+		queues:  make(map[eventKey]*eventQueue),
+		done:    make(chan struct{}),
+	}
+
+	b.mutex.Lock()
+	id := b.nextID
+	b.nextID++
+	b.subscribers[id] = sub
+	b.mutex.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mutex.Lock()
+			delete(b.subscribers, id)
+			b.mutex.Unlock()
+			close(sub.done)
+		})
+	}
+}
+
+// publish queues an event for every subscriber that accepts it.
+// It blocks while a subscriber's queue for the key is full.
+func (b *eventBus) publish(key eventKey, event interface{}) {
+	b.mutex.RLock()
+	subs := make([]*subscriber, 0, len(b.subscribers))
+	for _, sub := range b.subscribers {
+		if sub.accepts(event) {
+			subs = append(subs, sub)
+		}
+	}
+	b.mutex.RUnlock()
+
+	for _, sub := range subs {
+		sub.enqueue(b.ctx, key, event)
+	}
+}
+
+// enqueue adds an event to the queue for its key, starting a worker for new keys
+func (s *subscriber) enqueue(ctx context.Context, key eventKey, event interface{}) {
+	s.mutex.Lock()
+	queue, exists := s.queues[key]
+	if !exists {
+		queue = &eventQueue{events: make(chan interface{}, eventQueueSize)}
+		s.queues[key] = queue
+		go s.run(ctx, key, queue)
+	}
+	queue.pending++
+	s.mutex.Unlock()
+
+	select {
+	case queue.events <- event:
+	case <-s.done:
+	case <-ctx.Done():
+	}
+}
+
+// run handles the events of one queue in order, exiting once the queue stays idle
+func (s *subscriber) run(ctx context.Context, key eventKey, queue *eventQueue) {
+	idle := time.NewTimer(eventQueueIdleTTL)
+	defer idle.Stop()
+
+	for {
+		select {
+		case event := <-queue.events:
+			s.handle(event)
+
+			s.mutex.Lock()
+			queue.pending--
+			s.mutex.Unlock()
+
+			if !idle.Stop() {
+				<-idle.C
+			}
+			idle.Reset(eventQueueIdleTTL)
+		case <-idle.C:
+			// A publisher may hold the queue without having sent yet, so only
+			// retire it when nothing is pending
+			s.mutex.Lock()
+			if queue.pending == 0 {
+				delete(s.queues, key)
+				s.mutex.Unlock()
+				return
+			}
+			s.mutex.Unlock()
+			idle.Reset(eventQueueIdleTTL)
+		case <-s.done:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// SubscribePeerConnected calls the handler for every newly connected peer and returns a func that unsubscribes
+func (m *Manager) SubscribePeerConnected(handler func(PeerConnectedEvent)) func() {
+	return m.events.subscribe(
+		func(event interface{}) bool {
+			_, ok := event.(PeerConnectedEvent)
+			return ok
+		},
+		func(event interface{}) { handler(event.(PeerConnectedEvent)) },
+	)
+}
+
+// SubscribePeerDisconnected calls the handler for every fully disconnected peer and returns a func that unsubscribes
+func (m *Manager) SubscribePeerDisconnected(handler func(PeerDisconnectedEvent)) func() {
+	return m.events.subscribe(
+		func(event interface{}) bool {
+			_, ok := event.(PeerDisconnectedEvent)
+			return ok
+		},
+		func(event interface{}) { handler(event.(PeerDisconnectedEvent)) },
+	)
+}
+
+// SubscribePeerUpdated calls the handler for every profile received from an announced peer and returns a func that unsubscribes
+func (m *Manager) SubscribePeerUpdated(handler func(PeerUpdatedEvent)) func() {
+	return m.events.subscribe(
+		func(event interface{}) bool {
+			_, ok := event.(PeerUpdatedEvent)
+			return ok
+		},
+		func(event interface{}) { handler(event.(PeerUpdatedEvent)) },
+	)
+}
+
+// SubscribePeers calls the handlers for connected and disconnected peers through a single
+// subscription, so a peer's connection is always handled before its disconnection.
+// Either handler may be nil. It returns a func that unsubscribes.
+func (m *Manager) SubscribePeers(connected func(PeerConnectedEvent), disconnected func(PeerDisconnectedEvent)) func() {
+	return m.events.subscribe(
+		func(event interface{}) bool {
+			switch event.(type) {
+			case PeerConnectedEvent:
+				return connected != nil
+			case PeerDisconnectedEvent:
+				return disconnected != nil
+			}
+			return false
+		},
+		func(event interface{}) {
+			switch e := event.(type) {
+			case PeerConnectedEvent:
+				connected(e)
+			case PeerDisconnectedEvent:
+				disconnected(e)
+			}
+		},
+	)
+}
+
+// SubscribeMessages calls the handler for messages of a protocol, or of every protocol when it is empty.
+// Messages from one peer on one protocol are handled in order. A slow handler
+// delays only that peer and protocol, and blocks its streams once the queue is full.
+func (m *Manager) SubscribeMessages(proto protocol.ID, handler func(MessageEvent)) func() {
+	return m.events.subscribe(
+		func(event interface{}) bool {
+			msg, ok := event.(MessageEvent)
+			return ok && (proto == "" || msg.Protocol == proto)
+		},
+		func(event interface{}) { handler(event.(MessageEvent)) },
+	)
+}
@@ -0,0 +1,464 @@
+package network
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/control"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// Access modes deciding which peers may connect
+const (
+	AccessOpen      = "open"      // every peer except blocked ones
+	AccessAllowlist = "allowlist" // only peers on the allowlist
+	AccessAsk       = "ask"       // unknown Shario peers are refused until the user allows them
+)
+
+// askCooldown is how long an unanswered or declined contact request suppresses new ones from the same peer
+const askCooldown = 10 * time.Minute
+
+// inviteGrace is how long a Shario peer we would refuse may stay connected to redeem an invite
+const inviteGrace = 10 * time.Second
+
+// connectionGater enforces the access mode and lists on every connection
+type connectionGater struct {
+	access  *AccessList
+	mode    string
+	trusted map[peer.ID]bool // bootstrap peers, exempt from the allowlist but not the blocklist
+	asked   map[peer.ID]time.Time
+	onAsk   func(info peer.AddrInfo)
+	invites map[string]time.Time // nonces of the invites we issued by expiry, zero for none
+	lanOnly bool                 // LAN mode dials no address beyond the local network
+	mutex   sync.RWMutex
+}
+
+// newConnectionGater creates a gater for the given access mode
+func newConnectionGater(access *AccessList, mode string, trusted []peer.AddrInfo) (*connectionGater, error) {
+	if err := validateAccessMode(mode); err != nil {
+		return nil, err
+	}
+
+	g := &connectionGater{
+		access:  access,
+		mode:    mode,
+		trusted: make(map[peer.ID]bool),
+		asked:   make(map[peer.ID]time.Time),
+		invites: make(map[string]time.Time),
+	}
+	for _, info := range trusted {
+		g.trusted[info.ID] = true
+	}
+
+	return g, nil
+}
+
+// validateAccessMode checks an access mode name, treating empty as open
+func validateAccessMode(mode string) error {
+	switch mode {
+	case "", AccessOpen, AccessAllowlist, AccessAsk:
+		return nil
+	default:
+		return fmt.Errorf("unknown access mode: %s", mode)
+	}
+}
+
+// getMode returns the current access mode
+func (g *connectionGater) getMode() string {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+	if g.mode == "" {
+		return AccessOpen
+	}
+	return g.mode
+}
+
+// setMode switches the access mode
+func (g *connectionGater) setMode(mode string) error {
+	if err := validateAccessMode(mode); err != nil {
+		return err
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.mode = mode
+	return nil
+}
+
+// setLANOnly restricts connections to private and loopback addresses
+func (g *connectionGater) setLANOnly(lanOnly bool) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.lanOnly = lanOnly
+}
+
+// isLANOnly reports whether connections are restricted to the local network
+func (g *connectionGater) isLANOnly() bool {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+	return g.lanOnly
+}
+
+// outsideLAN reports whether LAN mode keeps us from using an address
+func (g *connectionGater) outsideLAN(addr multiaddr.Multiaddr) bool {
+	return g.isLANOnly() && len(lanAddrs([]multiaddr.Multiaddr{addr})) == 0
+}
+
+// setAskHandler sets the callback receiving contact requests from unknown peers
+func (g *connectionGater) setAskHandler(onAsk func(info peer.AddrInfo)) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.onAsk = onAsk
+}
+
+// permits reports whether the current mode lets the peer connect without asking
+func (g *connectionGater) permits(peerID peer.ID, ip net.IP) bool {
+	if g.access.IsBlocked(peerID, ip) {
+		return false
+	}
+	if g.getMode() == AccessOpen {
+		return true
+	}
+
+	g.mutex.RLock()
+	trusted := g.trusted[peerID]
+	g.mutex.RUnlock()
+
+	return trusted || g.access.IsAllowed(peerID, ip)
+}
+
+// refusal returns why a dial to the peer would be refused, or "" if it would not
+func (g *connectionGater) refusal(info peer.AddrInfo) string {
+	if g.access.IsBlocked(info.ID, nil) {
+		return "peer is blocked"
+	}
+	if g.getMode() != AccessAllowlist || g.permits(info.ID, nil) {
+		return ""
+	}
+
+	// An allowed network is enough, InterceptAddrDial drops the other addresses
+	for _, addr := range info.Addrs {
+		if ip := addrIP(addr); ip != nil && g.permits(info.ID, ip) {
+			return ""
+		}
+	}
+	return "peer is not on the allowlist"
+}
+
+// admits reports whether a dial to the peer would connect without asking for approval
+func (g *connectionGater) admits(info peer.AddrInfo) bool {
+	if g.refusal(info) != "" {
+		return false
+	}
+	if g.getMode() != AccessAsk || g.permits(info.ID, nil) {
+		return true
+	}
+
+	for _, addr := range info.Addrs {
+		if ip := addrIP(addr); ip != nil && g.permits(info.ID, ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// needsApproval reports whether a peer connected over the address is held back until the user
+// allows it or it redeems an invite. Allowlist mode only lets such peers in while invites are open.
+func (g *connectionGater) needsApproval(peerID peer.ID, addr multiaddr.Multiaddr) bool {
+	mode := g.getMode()
+	return (mode == AccessAsk || mode == AccessAllowlist) && !g.permits(peerID, addrIP(addr))
+}
+
+// addInvite records an invite we issued, so the peer redeeming it is let in
+func (g *connectionGater) addInvite(nonce string, expiresAt time.Time) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.invites[nonce] = expiresAt
+}
+
+// openInvites reports whether an invite we issued can still be redeemed, dropping expired ones
+func (g *connectionGater) openInvites() bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	for nonce, expiresAt := range g.invites {
+		if !expiresAt.IsZero() && time.Now().After(expiresAt) {
+			delete(g.invites, nonce)
+		}
+	}
+	return len(g.invites) > 0
+}
+
+// validInvite reports whether a nonce belongs to an invite we issued that has not expired
+func (g *connectionGater) validInvite(nonce string) bool {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	expiresAt, exists := g.invites[nonce]
+	return exists && (expiresAt.IsZero() || time.Now().Before(expiresAt))
+}
+
+// pending reports whether a contact request for the peer is still awaiting an answer
+func (g *connectionGater) pending(peerID peer.ID) bool {
+	if g.getMode() != AccessAsk || g.permits(peerID, nil) {
+		return false
+	}
+
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+	askedAt, exists := g.asked[peerID]
+	return exists && time.Since(askedAt) < askCooldown
+}
+
+// ask raises a contact request for an unknown peer unless one was raised recently.
+// Connections refused while a request is pending are not logged.
+func (g *connectionGater) ask(peerID peer.ID, addr multiaddr.Multiaddr) {
+	g.mutex.Lock()
+	if askedAt, exists := g.asked[peerID]; exists && time.Since(askedAt) < askCooldown {
+		g.mutex.Unlock()
+		return
+	}
+	// Requests past their cooldown no longer suppress anything
+	for id, askedAt := range g.asked {
+		if time.Since(askedAt) >= askCooldown {
+			delete(g.asked, id)
+		}
+	}
+	g.asked[peerID] = time.Now()
+	onAsk := g.onAsk
+	g.mutex.Unlock()
+
+	log.Printf("🚫 Refused unknown Shario peer %s, asking for approval", peerID)
+
+	if onAsk != nil {
+		go onAsk(peer.AddrInfo{ID: peerID, Addrs: []multiaddr.Multiaddr{addr}})
+	}
+}
+
+// InterceptPeerDial refuses dials to blocked peers
+func (g *connectionGater) InterceptPeerDial(peerID peer.ID) bool {
+	return !g.access.IsBlocked(peerID, nil)
+}
+
+// InterceptAddrDial refuses dials to blocked addresses, in allowlist mode to peers that are not
+// allowed, and in LAN mode to addresses beyond the local network
+func (g *connectionGater) InterceptAddrDial(peerID peer.ID, addr multiaddr.Multiaddr) bool {
+	if g.outsideLAN(addr) {
+		return false
+	}
+
+	ip := addrIP(addr)
+	if g.getMode() == AccessAllowlist {
+		return g.permits(peerID, ip)
+	}
+	return !g.access.IsBlocked("", ip)
+}
+
+// InterceptAccept refuses inbound connections from blocked addresses before the handshake, and in
+// LAN mode from beyond the local network, such as through a mapped port or a relay
+func (g *connectionGater) InterceptAccept(addrs network.ConnMultiaddrs) bool {
+	if g.outsideLAN(addrs.RemoteMultiaddr()) {
+		return false
+	}
+	return !g.access.IsBlocked("", addrIP(addrs.RemoteMultiaddr()))
+}
+
+// InterceptSecured decides once the remote peer ID is known. Ask mode lets unknown peers
+// connect, as most are DHT nodes, and only asks about them once they turn out to run Shario.
+// Shario peers we already asked about are refused right away until the request expires.
+// Allowlist mode lets unknown peers connect while our invites are open, so they can redeem one.
+func (g *connectionGater) InterceptSecured(dir network.Direction, peerID peer.ID, addrs network.ConnMultiaddrs) bool {
+	ip := addrIP(addrs.RemoteMultiaddr())
+	if g.permits(peerID, ip) {
+		return true
+	}
+	if !g.access.IsBlocked(peerID, ip) {
+		switch g.getMode() {
+		case AccessAsk:
+			return !g.pending(peerID)
+		case AccessAllowlist:
+			if g.openInvites() {
+				return true
+			}
+		}
+	}
+
+	log.Printf("🚫 Refused connection with peer %s (%s)", peerID, addrs.RemoteMultiaddr())
+	return false
+}
+
+// InterceptUpgraded accepts every connection that passed the earlier checks
+func (g *connectionGater) InterceptUpgraded(network.Conn) (bool, control.DisconnectReason) {
+	return true, 0
+}
+
+// addrIP returns the IP address of a multiaddr, or nil for addresses without one
+func addrIP(addr multiaddr.Multiaddr) net.IP {
+	if addr == nil {
+		return nil
+	}
+	ip, err := manet.ToIP(addr)
+	if err != nil {
+		return nil
+	}
+	return ip
+}
+
+// AccessMode returns the current access mode
+func (m *Manager) AccessMode() string {
+	return m.gater.getMode()
+}
+
+// SetAccessMode switches the access mode and closes connections the new mode refuses
+func (m *Manager) SetAccessMode(mode string) error {
+	if err := m.gater.setMode(mode); err != nil {
+		return err
+	}
+	m.closeRefusedConns()
+	return nil
+}
+
+// SetContactRequestHandler sets the callback asked to approve unknown peers in ask mode.
+// Approving a peer means allowing it and connecting again.
+func (m *Manager) SetContactRequestHandler(handler func(info peer.AddrInfo)) {
+	m.handlersMutex.Lock()
+	defer m.handlersMutex.Unlock()
+	m.contactHandler = handler
+}
+
+// Allow adds a peer ID, IP address or CIDR network to the allowlist
+func (m *Manager) Allow(entry string) error {
+	return m.gater.access.Allow(entry)
+}
+
+// Disallow removes an entry from the allowlist and closes connections it no longer permits
+func (m *Manager) Disallow(entry string) error {
+	if err := m.gater.access.Disallow(entry); err != nil {
+		return err
+	}
+	m.closeRefusedConns()
+	return nil
+}
+
+// Block adds a peer ID, IP address or CIDR network to the blocklist and disconnects matching peers
+func (m *Manager) Block(entry string) error {
+	if err := m.gater.access.Block(entry); err != nil {
+		return err
+	}
+	log.Printf("🚫 Blocked %s", entry)
+	m.closeRefusedConns()
+	return nil
+}
+
+// Unblock removes an entry from the blocklist
+func (m *Manager) Unblock(entry string) error {
+	if err := m.gater.access.Unblock(entry); err != nil {
+		return err
+	}
+	log.Printf("Unblocked %s", entry)
+	return nil
+}
+
+// AllowedEntries returns the allowlist
+func (m *Manager) AllowedEntries() []string {
+	return m.gater.access.Allowed()
+}
+
+// BlockedEntries returns the blocklist
+func (m *Manager) BlockedEntries() []string {
+	return m.gater.access.Blocked()
+}
+
+// closeRefusedConns closes connections that the access mode and lists no longer permit.
+// Unknown peers connected before switching to ask mode are kept.
+func (m *Manager) closeRefusedConns() {
+	mode := m.gater.getMode()
+	for _, conn := range m.host.Network().Conns() {
+		peerID := conn.RemotePeer()
+		ip := addrIP(conn.RemoteMultiaddr())
+
+		refused := m.gater.access.IsBlocked(peerID, ip)
+		if mode == AccessAllowlist && !m.gater.permits(peerID, ip) {
+			refused = true
+		}
+
+		if refused {
+			log.Printf("🚫 Closing connection with %s (%s)", peerID, conn.RemoteMultiaddr())
+			conn.Close()
+		}
+	}
+}
+
+// holdBack refuses a Shario peer that is not allowed yet: in ask mode the user is asked about it,
+// and its connections are closed. While our invites are open the peer first gets inviteGrace to
+// redeem one. It reports whether the peer was held back.
+func (m *Manager) holdBack(peerID peer.ID) bool {
+	conns := m.host.Network().ConnsToPeer(peerID)
+	if len(conns) == 0 {
+		return false
+	}
+	for _, conn := range conns {
+		if !m.gater.needsApproval(peerID, conn.RemoteMultiaddr()) {
+			return false
+		}
+	}
+
+	if m.gater.openInvites() {
+		m.awaitInvite(peerID)
+	} else {
+		m.refuse(peerID, conns)
+	}
+	return true
+}
+
+// awaitInvite refuses a held back peer unless it redeemed an invite within inviteGrace
+func (m *Manager) awaitInvite(peerID peer.ID) {
+	m.invitesMutex.Lock()
+	defer m.invitesMutex.Unlock()
+	if m.awaiting[peerID] {
+		return
+	}
+	m.awaiting[peerID] = true
+
+	time.AfterFunc(inviteGrace, func() {
+		m.invitesMutex.Lock()
+		delete(m.awaiting, peerID)
+		m.invitesMutex.Unlock()
+
+		conns := m.host.Network().ConnsToPeer(peerID)
+		if len(conns) > 0 && m.gater.needsApproval(peerID, conns[0].RemoteMultiaddr()) {
+			m.refuse(peerID, conns)
+		}
+	})
+}
+
+// refuse closes the connections of a held back peer, asking the user about it in ask mode
+func (m *Manager) refuse(peerID peer.ID, conns []network.Conn) {
+	if m.gater.getMode() == AccessAsk {
+		m.gater.ask(peerID, conns[0].RemoteMultiaddr())
+	} else {
+		log.Printf("🚫 Refused peer %s, it is not on the allowlist", peerID)
+	}
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
+
+// notifyContactRequest passes a contact request from an unknown peer to the handler
+func (m *Manager) notifyContactRequest(info peer.AddrInfo) {
+	m.handlersMutex.RLock()
+	handler := m.contactHandler
+	m.handlersMutex.RUnlock()
+
+	if handler == nil {
+		log.Printf("No one to ask about peer %s, add it to the allowlist to accept it", info.ID)
+		return
+	}
+	handler(info)
+}
@@ -0,0 +1,221 @@
+package network
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// HelloProtocol exchanges peer profiles when a connection opens
+const HelloProtocol = protocol.ID("/shario/hello/1.0.0")
+
+// helloTimeout is how long a new peer is held back from handlers while waiting for its profile
+const helloTimeout = 5 * time.Second
+
+// Profile describes a peer to the peers it connects to
+type Profile struct {
+	Nickname     string           `json:"nickname"`
+	Version      string           `json:"version"`
+	Protocols    []string         `json:"protocols"`
+	AvatarHash   string           `json:"avatar_hash,omitempty"`
+	Capabilities []string         `json:"capabilities,omitempty"`
+	Workspaces   []WorkspaceClaim `json:"workspaces,omitempty"`
+}
+
+// SetVersion sets the application version announced to peers
+func (m *Manager) SetVersion(version string) {
+	m.profileMutex.Lock()
+	defer m.profileMutex.Unlock()
+	m.version = version
+}
+
+// SetAvatarHash sets the hash of our avatar announced to peers
+func (m *Manager) SetAvatarHash(hash string) {
+	m.profileMutex.Lock()
+	defer m.profileMutex.Unlock()
+	m.avatarHash = hash
+}
+
+// AddCapability announces an optional feature, such as a transfer extension, to peers
+func (m *Manager) AddCapability(capability string) {
+	m.profileMutex.Lock()
+	defer m.profileMutex.Unlock()
+	m.capabilities = appendUnique(m.capabilities, capability)
+}
+
+// HasCapability reports whether the peer announced a capability in its profile
+func (p *Peer) HasCapability(capability string) bool {
+	for _, c := range p.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// localProfile returns the profile we send to a peer
+func (m *Manager) localProfile(remote peer.ID) Profile {
+	m.profileMutex.RLock()
+	defer m.profileMutex.RUnlock()
+
+	profile := Profile{
+		Version:      m.version,
+		Protocols:    localProtocols(),
+		AvatarHash:   m.avatarHash,
+		Capabilities: append([]string(nil), m.capabilities...),
+		Workspaces:   m.workspaceClaims(remote),
+	}
+	if m.identity != nil {
+		profile.Nickname = m.identity.GetNickname()
+	}
+	return profile
+}
+
+// greet sends our profile to a newly connected peer and announces the peer to
+// handlers once its own profile arrived, so they see its real nickname.
+// Peers without the hello protocol are announced right away.
+func (m *Manager) greet(peerID peer.ID, generation uint64, received chan struct{}) {
+	defer func() {
+		m.profileMutex.Lock()
+		if m.hellos[peerID] == received {
+			delete(m.hellos, peerID)
+		}
+		m.profileMutex.Unlock()
+	}()
+
+	if err := m.sendHello(peerID); err != nil {
+		log.Printf("No profile exchange with peer %s: %v", peerID, err)
+	} else {
+		select {
+		case <-received:
+		case <-time.After(helloTimeout):
+			log.Printf("Peer %s did not send its profile in time", peerID)
+		case <-m.ctx.Done():
+			return
+		}
+	}
+
+	m.announceMutex.Lock()
+	defer m.announceMutex.Unlock()
+
+	// The peer may have disconnected, or even reconnected as a new entry, meanwhile.
+	// Handlers get a copy, the entry keeps changing as profiles and pings arrive.
+	m.peersMutex.RLock()
+	current, exists := m.peers[peerID]
+	if !exists || current.generation != generation {
+		m.peersMutex.RUnlock()
+		return
+	}
+	info := copyPeer(current)
+	m.peersMutex.RUnlock()
+
+	m.announced[peerID] = true
+	m.notifyPeerConnected(info)
+}
+
+// sendHello writes our profile to a hello stream
+func (m *Manager) sendHello(peerID peer.ID) error {
+	data, err := json.Marshal(m.localProfile(peerID))
+	if err != nil {
+		return fmt.Errorf("failed to marshal profile: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(m.ctx, helloTimeout)
+	defer cancel()
+
+	stream, err := m.host.NewStream(ctx, peerID, HelloProtocol)
+	if err != nil {
+		return fmt.Errorf("failed to create hello stream: %w", err)
+	}
+	defer stream.Close()
+
+	stream.SetWriteDeadline(time.Now().Add(helloTimeout))
+	if _, err := stream.Write(data); err != nil {
+		stream.Reset()
+		return fmt.Errorf("failed to send profile: %w", err)
+	}
+
+	return nil
+}
+
+// handleHelloStream stores the profile a peer sent us
+func (m *Manager) handleHelloStream(stream network.Stream) {
+	defer stream.Close()
+	peerID := stream.Conn().RemotePeer()
+
+	stream.SetReadDeadline(time.Now().Add(helloTimeout))
+	data, err := readMessage(stream)
+	if err != nil {
+		log.Printf("Failed to read profile from peer %s: %v", peerID, err)
+		return
+	}
+
+	var profile Profile
+	if err := json.Unmarshal(data, &profile); err != nil {
+		log.Printf("Failed to unmarshal profile from peer %s: %v", peerID, err)
+		return
+	}
+
+	// Speaking the hello protocol makes it a Shario peer, even if our identify is still running
+	m.admitPeer(peerID)
+	m.applyProfile(peerID, profile)
+}
+
+// applyProfile copies a received profile onto the connected peer
+func (m *Manager) applyProfile(peerID peer.ID, profile Profile) {
+	workspaces := m.sharedWorkspaces(peerID, profile.Workspaces)
+	protocols := make([]protocol.ID, 0, len(profile.Protocols))
+	for _, proto := range profile.Protocols {
+		protocols = append(protocols, protocol.ID(proto))
+	}
+
+	m.peersMutex.Lock()
+	p, exists := m.peers[peerID]
+	if exists {
+		if profile.Nickname != "" {
+			p.Nickname = profile.Nickname
+		}
+		p.Version = profile.Version
+		p.Protocols = protocols
+		p.AvatarHash = profile.AvatarHash
+		p.Capabilities = profile.Capabilities
+		p.Workspaces = workspaces
+	}
+	m.peersMutex.Unlock()
+
+	if !exists {
+		return
+	}
+	log.Printf("👋 Peer %s is %s (version %s)", peerID, profile.Nickname, profile.Version)
+
+	if profile.Nickname != "" {
+		if err := m.addressBook.SetNickname(peerID, profile.Nickname); err != nil {
+			log.Printf("Failed to save address book: %v", err)
+		}
+	}
+
+	m.profileMutex.Lock()
+	received, waiting := m.hellos[peerID]
+	delete(m.hellos, peerID)
+	m.profileMutex.Unlock()
+
+	if waiting {
+		close(received)
+		return
+	}
+
+	// Handlers already saw the peer without this profile, for example after the hello timed out
+	m.announceMutex.Lock()
+	defer m.announceMutex.Unlock()
+	if m.announced[peerID] {
+		if info, exists := m.GetPeerInfo(peerID); exists {
+			m.notifyPeerUpdated(info)
+		}
+	}
+}
@@ -0,0 +1,365 @@
+package network
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// InvitePrefix identifies an encoded invite code
+const InvitePrefix = "shario-invite:"
+
+// InviteProtocol lets an invited peer redeem its invite with the peer that issued it
+const InviteProtocol = protocol.ID("/shario/invite/1.0.0")
+
+// maxInviteAddrs keeps invite codes short enough for a QR code
+const maxInviteAddrs = 8
+
+// inviteTimeout bounds redeeming an invite
+const inviteTimeout = 10 * time.Second
+
+// Invite is the decoded content of an invite code, signed by the inviting peer
+type Invite struct {
+	PeerID    string   `json:"p"`
+	PublicKey []byte   `json:"k,omitempty"` // only for keys the peer ID does not embed, such as RSA
+	Addrs     []string `json:"a"`
+	Workspace string   `json:"w,omitempty"`
+	ExpiresAt int64    `json:"e,omitempty"` // unix seconds, zero means no expiry
+	Nonce     string   `json:"n,omitempty"` // presented to the inviting peer, which admits the holder until expiry
+	Signature []byte   `json:"s,omitempty"`
+}
+
+// inviteRedemption is sent by an invited peer over the invite protocol
+type inviteRedemption struct {
+	Nonce string `json:"nonce"`
+}
+
+// inviteAnswer tells an invited peer whether the invite was accepted
+type inviteAnswer struct {
+	Accepted bool `json:"accepted"`
+}
+
+// String encodes the invite for copying, pasting and QR codes
+func (i *Invite) String() string {
+	data, _ := json.Marshal(i)
+	return InvitePrefix + base64.RawURLEncoding.EncodeToString(data)
+}
+
+// signingBytes returns the canonical bytes covered by the invite signature
+func (i *Invite) signingBytes() ([]byte, error) {
+	unsigned := *i
+	unsigned.Signature = nil
+	return json.Marshal(unsigned)
+}
+
+// ParseInvite decodes an invite code and validates it
+func ParseInvite(code string) (*Invite, error) {
+	code = strings.TrimSpace(code)
+	if !strings.HasPrefix(code, InvitePrefix) {
+		return nil, fmt.Errorf("not an invite code")
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(code, InvitePrefix))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode invite code: %w", err)
+	}
+
+	var invite Invite
+	if err := json.Unmarshal(data, &invite); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal invite code: %w", err)
+	}
+
+	if err := invite.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &invite, nil
+}
+
+// Validate checks that the invite is complete, unexpired and signed by the peer it names
+func (i *Invite) Validate() error {
+	if i.PeerID == "" || len(i.Addrs) == 0 {
+		return fmt.Errorf("incomplete invite code")
+	}
+
+	if i.ExpiresAt != 0 && time.Now().Unix() > i.ExpiresAt {
+		return fmt.Errorf("invite code expired at %s", time.Unix(i.ExpiresAt, 0).Format(time.RFC1123))
+	}
+
+	if i.Workspace != "" && !workspaceNamePattern.MatchString(i.Workspace) {
+		return fmt.Errorf("invalid workspace name in invite code: %q", i.Workspace)
+	}
+
+	peerID, err := peer.Decode(i.PeerID)
+	if err != nil {
+		return fmt.Errorf("invalid peer ID in invite code: %w", err)
+	}
+
+	publicKey, err := i.publicKey(peerID)
+	if err != nil {
+		return err
+	}
+
+	data, err := i.signingBytes()
+	if err != nil {
+		return fmt.Errorf("failed to encode invite: %w", err)
+	}
+	valid, err := publicKey.Verify(data, i.Signature)
+	if err != nil {
+		return fmt.Errorf("failed to verify invite signature: %w", err)
+	}
+	if !valid {
+		return fmt.Errorf("invalid invite signature")
+	}
+
+	return nil
+}
+
+// publicKey returns the key the invite is signed with, taken from the peer ID when it embeds one
+func (i *Invite) publicKey(peerID peer.ID) (crypto.PubKey, error) {
+	if publicKey, err := peerID.ExtractPublicKey(); err == nil {
+		return publicKey, nil
+	}
+
+	publicKey, err := crypto.UnmarshalPublicKey(i.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key in invite code: %w", err)
+	}
+	if !peerID.MatchesPublicKey(publicKey) {
+		return nil, fmt.Errorf("invite code key does not match peer %s", peerID)
+	}
+	return publicKey, nil
+}
+
+// AddrInfo returns the peer address info encoded in the invite
+func (i *Invite) AddrInfo() (*peer.AddrInfo, error) {
+	peerID, err := peer.Decode(i.PeerID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid peer ID in invite code: %w", err)
+	}
+
+	info := &peer.AddrInfo{ID: peerID}
+	for _, addrStr := range i.Addrs {
+		addr, err := multiaddr.NewMultiaddr(addrStr)
+		if err != nil {
+			continue
+		}
+		info.Addrs = append(info.Addrs, addr)
+	}
+	if len(info.Addrs) == 0 {
+		return nil, fmt.Errorf("invite code has no valid addresses")
+	}
+
+	return info, nil
+}
+
+// inviteAddrs returns the addresses worth putting in an invite
+func (m *Manager) inviteAddrs() []string {
+	var addrs []string
+	for _, addr := range m.host.Addrs() {
+		if !shareableAddr(addr) {
+			continue
+		}
+		addrs = append(addrs, addr.String())
+		if len(addrs) == maxInviteAddrs {
+			break
+		}
+	}
+	return addrs
+}
+
+// CreateInvite returns a signed invite code for connecting to us, optionally naming
+// one of our workspaces. A ttl of zero means the invite never expires.
+func (m *Manager) CreateInvite(workspace string, ttl time.Duration) (*Invite, error) {
+	if workspace != "" && !m.inWorkspace(workspace) {
+		return nil, fmt.Errorf("not a member of workspace %s", workspace)
+	}
+
+	addrs := m.inviteAddrs()
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no reachable addresses to invite peers to")
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate invite nonce: %w", err)
+	}
+
+	invite := &Invite{
+		PeerID:    m.host.ID().String(),
+		Addrs:     addrs,
+		Workspace: workspace,
+		Nonce:     hex.EncodeToString(nonce),
+	}
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+		invite.ExpiresAt = expiresAt.Unix()
+	}
+
+	// Peer IDs of Ed25519 keys embed the key, others need it spelled out
+	if _, err := m.host.ID().ExtractPublicKey(); err != nil {
+		publicKey, err := crypto.MarshalPublicKey(m.identity.GetPublicKey())
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode public key: %w", err)
+		}
+		invite.PublicKey = publicKey
+	}
+
+	data, err := invite.signingBytes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode invite: %w", err)
+	}
+
+	signature, err := m.identity.SignData(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign invite: %w", err)
+	}
+
+	invite.Signature = signature
+	m.gater.addInvite(invite.Nonce, expiresAt)
+	return invite, nil
+}
+
+// AcceptInvite validates an invite code and connects to the peer behind it
+func (m *Manager) AcceptInvite(ctx context.Context, code string) (*Invite, error) {
+	invite, err := ParseInvite(code)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := invite.AddrInfo()
+	if err != nil {
+		return nil, err
+	}
+	if info.ID == m.host.ID() {
+		return nil, fmt.Errorf("the invite code is our own")
+	}
+
+	// Accepting an invite approves the peer when unknown peers are refused or need approval
+	if mode := m.AccessMode(); mode == AccessAsk || mode == AccessAllowlist {
+		if err := m.Allow(info.ID.String()); err != nil {
+			return nil, fmt.Errorf("failed to allow peer: %w", err)
+		}
+	}
+
+	log.Printf("🔗 Accepting invite from peer %s", info.ID)
+	if err := m.Connect(ctx, *info); err != nil {
+		return nil, err
+	}
+
+	// The inviting peer may only let us in once we redeem the invite
+	if invite.Nonce != "" {
+		if err := m.redeemInvite(ctx, info.ID, invite.Nonce); err != nil {
+			log.Printf("⚠️ Failed to redeem invite with peer %s: %v", info.ID, err)
+		}
+	}
+
+	if invite.Workspace != "" && !m.inWorkspace(invite.Workspace) {
+		log.Printf("⚠️ Invite names workspace %s, join it to chat in its room", invite.Workspace)
+	}
+
+	return invite, nil
+}
+
+// redeemInvite presents an invite nonce to the peer that issued it. A profile we sent before
+// the peer admitted us was dropped, so it is sent again once the invite is accepted.
+func (m *Manager) redeemInvite(ctx context.Context, peerID peer.ID, nonce string) error {
+	data, err := json.Marshal(inviteRedemption{Nonce: nonce})
+	if err != nil {
+		return fmt.Errorf("failed to marshal invite redemption: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, inviteTimeout)
+	defer cancel()
+
+	stream, err := m.host.NewStream(ctx, peerID, InviteProtocol)
+	if err != nil {
+		return fmt.Errorf("failed to create invite stream: %w", err)
+	}
+	defer stream.Close()
+	stream.SetDeadline(time.Now().Add(inviteTimeout))
+
+	if _, err := stream.Write(data); err != nil {
+		stream.Reset()
+		return fmt.Errorf("failed to send invite redemption: %w", err)
+	}
+	stream.CloseWrite()
+
+	data, err = readMessage(stream)
+	if err != nil {
+		return fmt.Errorf("failed to read invite answer: %w", err)
+	}
+	var answer inviteAnswer
+	if err := json.Unmarshal(data, &answer); err != nil {
+		return fmt.Errorf("failed to unmarshal invite answer: %w", err)
+	}
+	if !answer.Accepted {
+		return fmt.Errorf("invite was not accepted")
+	}
+
+	return m.sendHello(peerID)
+}
+
+// handleInviteStream admits a peer that redeems one of our open invites, adding it to the
+// allowlist when unknown peers are refused or need approval
+func (m *Manager) handleInviteStream(stream network.Stream) {
+	defer stream.Close()
+	peerID := stream.Conn().RemotePeer()
+
+	stream.SetDeadline(time.Now().Add(inviteTimeout))
+	data, err := readMessage(stream)
+	if err != nil {
+		log.Printf("Failed to read invite redemption from peer %s: %v", peerID, err)
+		return
+	}
+
+	var redemption inviteRedemption
+	if err := json.Unmarshal(data, &redemption); err != nil {
+		log.Printf("Failed to unmarshal invite redemption from peer %s: %v", peerID, err)
+		return
+	}
+
+	answer := inviteAnswer{Accepted: m.gater.validInvite(redemption.Nonce)}
+	if answer.Accepted {
+		log.Printf("🔗 Peer %s redeemed an invite", peerID)
+		if mode := m.AccessMode(); mode == AccessAsk || mode == AccessAllowlist {
+			if err := m.Allow(peerID.String()); err != nil {
+				log.Printf("Failed to allow peer %s: %v", peerID, err)
+				answer.Accepted = false
+			}
+		}
+	} else {
+		log.Printf("⚠️ Peer %s presented an unknown or expired invite", peerID)
+	}
+
+	// Admit the peer before answering, so the profile it sends next finds it listed
+	if answer.Accepted {
+		m.admitPeer(peerID)
+	}
+	if data, err = json.Marshal(answer); err == nil {
+		stream.Write(data)
+	}
+}
+
+// inWorkspace reports whether this node joined a workspace
+func (m *Manager) inWorkspace(name string) bool {
+	for _, workspace := range m.workspaces {
+		if workspace.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -4,7 +4,10 @@ package network
 import (
 	"context"
 	"fmt"
+	"io"
 	"log"
+	"path/filepath"
+	"shario/internal/config"
 	"shario/internal/identity"
 	"sync"
 	"time"
@@ -12,16 +15,15 @@ import (
 	"github.com/libp2p/go-libp2p"
 	"github.com/libp2p/go-libp2p-kad-dht"
 	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/metrics"
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/protocol"
-	"github.com/libp2p/go-libp2p/p2p/discovery/mdns"
-	"github.com/libp2p/go-libp2p/p2p/discovery/routing"
 	"github.com/multiformats/go-multiaddr"
 )
 
 const (
-	// Protocol IDs
+	// Protocol IDs of the first versions, see protocolVersions for the newer ones
 	ChatProtocol     = protocol.ID("/shario/chat/1.0.0")
 	TransferProtocol = protocol.ID("/shario/transfer/1.0.0")
 
@@ -30,6 +32,9 @@ const (
 
 	// Connection timeouts
 	ConnectionTimeout = 30 * time.Second
+
+	// MaxMessageSize limits a single protocol message read from a stream
+	MaxMessageSize = 64 * 1024
 )
 
 // Peer represents a connected peer
@@ -39,27 +44,101 @@ type Peer struct {
 	ConnectedAt time.Time
 	PeerID      peer.ID
 	Addresses   []multiaddr.Multiaddr
+	Flagged     bool   // set when the peer exceeded a limit or misbehaved
+	FlagReason  string // reason code of the most recent flag
+
+	// Profile sent by the peer when it connected, empty for peers without the hello protocol
+	Version      string
+	Protocols    []protocol.ID
+	AvatarHash   string
+	Capabilities []string
+	Workspaces   []string // our workspaces the peer proved membership of
+
+	// Connection quality, refreshed by periodic pings
+	RTTs      []time.Duration // most recent round trip times, oldest first
+	ConnType  string          // lan, direct or relayed
+	Transport string          // tcp, quic, websocket or webtransport
+	BytesIn   int64
+	BytesOut  int64
+
+	generation uint64 // tells this entry apart from earlier and later connections of the same peer
+	leaving    bool   // set when the peer said it is shutting down, tags its disconnect event
+}
+
+// defaultNickname is shown for a peer until it tells us its nickname
+func defaultNickname(peerID peer.ID) string {
+	return peerID.String()[:8]
 }
 
 // Manager handles all P2P networking operations
 type Manager struct {
 	// Core components
-	host        host.Host
-	dht         *dht.IpfsDHT
-	discovery   mdns.Service
-	routingDisc *routing.RoutingDiscovery
-	identity    *identity.Manager
+	host     host.Host
+	identity *identity.Manager
+
+	// Discovery, restarted when the network mode changes
+	mode              string
+	natEnabled        bool // NAT traversal is set up when the host is created, LAN mode only gates it
+	builtinDiscovery  bool // mDNS, the DHT, rendezvous points and peer exchange, never on NewWithHost hosts
+	dhtEnabled        bool
+	dhtOpts           []dht.Option
+	dhtProtocol       protocol.ID
+	rendezvousPoints  []peer.AddrInfo
+	rendezvous        *rendezvousServer // nil unless we serve as a rendezvous point
+	pexEnabled        bool
+	pexMaxPeers       int
+	workspaces        []Workspace
+	discoverers       []Discoverer // running discovery backends
+	customDiscoverers []Discoverer // added with AddDiscoverer
+	discoveryCtx      context.Context
+	discoveryCancel   context.CancelFunc
+	modeMutex         sync.Mutex
 
 	// State management
 	ctx           context.Context
 	cancel        context.CancelFunc
 	peers         map[peer.ID]*Peer
+	peerEntries   uint64 // peer entries created so far, numbers their generations
 	peersMutex    sync.RWMutex
-	eventHandlers map[string][]NetworkEventHandler
+	events        *eventBus
+	eventHandlers map[string][]func() // unsubscribe funcs of legacy handlers by name
 	handlersMutex sync.RWMutex
 
+	// Peers handlers were told about. Announcing and removing peers under announceMutex
+	// lets handlers see every peer connect before it disconnects.
+	announced     map[peer.ID]bool
+	announceMutex sync.Mutex
+
+	// Access control
+	gater          *connectionGater
+	contactHandler func(info peer.AddrInfo)
+	awaiting       map[peer.ID]bool // held back peers given time to redeem an invite
+	invitesMutex   sync.Mutex
+
+	// NAT traversal
+	reachability      network.Reachability
+	reachabilityMutex sync.RWMutex
+	forcedPublic      bool // the relay service skips AutoNAT and always claims public reachability
+
+	// Traffic accounting, nil when the host has no bandwidth reporter
+	bandwidth *metrics.BandwidthCounter
+
+	// Known peers
+	addressBook    *AddressBook
+	reconnects     map[peer.ID]*reconnectState
+	reconnectMutex sync.Mutex
+
+	// Profile exchange
+	version      string
+	avatarHash   string
+	capabilities []string
+	hellos       map[peer.ID]chan struct{} // closed when the peer's profile arrives
+	profileMutex sync.RWMutex
+
 	// Configuration
-	listenAddrs []multiaddr.Multiaddr
+	listenAddrs    []multiaddr.Multiaddr
+	bootstrapPeers []peer.AddrInfo
+	pskFingerprint string // set when running in a private network
 }
 
 // NetworkEventHandler defines the interface for network event callbacks
@@ -70,22 +149,121 @@ type NetworkEventHandler interface {
 }
 
 // New creates a new network manager
-func New(ctx context.Context, identityMgr *identity.Manager) (*Manager, error) {
-	netCtx, cancel := context.WithCancel(ctx)
+func New(ctx context.Context, identityMgr *identity.Manager, cfg config.NetworkConfig) (*Manager, error) {
+	// A pre-shared key restricts us to a private network
+	var hostOpts []libp2p.Option
+	var pskFingerprint string
+	if cfg.PSKFile != "" {
+		psk, err := LoadPSK(cfg.PSKFile)
+		if err != nil {
+			return nil, err
+		}
+		hostOpts = append(hostOpts, libp2p.PrivateNetwork(psk))
+		pskFingerprint = PSKFingerprint(psk)
+		log.Printf("🔒 Private network enabled, key fingerprint %s", pskFingerprint)
+
+		// libp2p cannot run QUIC inside a private network
+		cfg.Transports = withoutTransport(cfg.Transports, TransportQUIC)
+		if !cfg.DHT.Private {
+			log.Printf("⚠️ Public DHT peers cannot join a private network, consider enabling the private DHT")
+		}
+	}
+
+	transports, err := transportOptions(cfg.Transports)
+	if err != nil {
+		return nil, err
+	}
+	hostOpts = append(hostOpts, transports...)
 
 	// Create listen addresses
-	listenAddrs := []multiaddr.Multiaddr{
-		multiaddr.StringCast("/ip4/0.0.0.0/tcp/0"),
-		multiaddr.StringCast("/ip6/::/tcp/0"),
+	listenAddrs, err := listenAddrsFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	dhtOpts, bootstrapPeers, err := dhtOptions(cfg.DHT)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateNetworkMode(cfg.Mode); err != nil {
+		return nil, err
+	}
+	workspaces, err := workspacesFromConfig(cfg.Workspaces)
+	if err != nil {
+		return nil, err
+	}
+	mode := cfg.Mode
+	if mode == "" {
+		mode = ModeInternet
 	}
 
+	// Port mapping, hole punching and relays reach beyond the local network
+	natOpts, relays, err := natOptions(cfg.Relay)
+	if err != nil {
+		return nil, err
+	}
+	if mode == ModeInternet {
+		hostOpts = append(hostOpts, natOpts...)
+	}
+	if mode == ModeLAN {
+		hostOpts = append(hostOpts, libp2p.DisableRelay())
+	}
+
+	rendezvousPoints, err := parsePeerAddrs("rendezvous", cfg.Rendezvous.Points)
+	if err != nil {
+		return nil, err
+	}
+
+	// Gate every connection through the persistent access lists
+	configDir, err := config.Dir()
+	if err != nil {
+		return nil, err
+	}
+	access, err := NewAccessList(filepath.Join(configDir, "access.json"))
+	if err != nil {
+		return nil, err
+	}
+	trusted := append(append(bootstrapPeers, relays...), rendezvousPoints...)
+	gater, err := newConnectionGater(access, cfg.AccessMode, trusted)
+	if err != nil {
+		return nil, err
+	}
+	gater.setLANOnly(mode == ModeLAN)
+	hostOpts = append(hostOpts, libp2p.ConnectionGater(gater))
+
+	// Announce only addresses remote peers can use, in LAN mode not even mapped or relayed ones
+	factory, err := addrsFactory(cfg)
+	if err != nil {
+		return nil, err
+	}
+	hostOpts = append(hostOpts, libp2p.AddrsFactory(func(addrs []multiaddr.Multiaddr) []multiaddr.Multiaddr {
+		addrs = factory(addrs)
+		if gater.isLANOnly() {
+			return lanAddrs(addrs)
+		}
+		return addrs
+	}))
+
+	// Count traffic per peer and protocol
+	bandwidth := metrics.NewBandwidthCounter()
+	hostOpts = append(hostOpts, libp2p.BandwidthReporter(bandwidth))
+
+	addressBook, err := NewAddressBook(filepath.Join(configDir, "peers.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	netCtx, cancel := context.WithCancel(ctx)
+
 	// Create libp2p host
-	h, err := libp2p.New(
-		libp2p.Identity(identityMgr.GetPrivateKey()),
-		libp2p.ListenAddrs(listenAddrs...),
-		libp2p.NATPortMap(),
-		libp2p.EnableAutoRelayWithStaticRelays([]peer.AddrInfo{}),
-	)
+	h, err := newHost(identityMgr, listenAddrs, cfg.Limits, hostOpts)
+	if err != nil {
+		// Saved ports may have been taken by another program since the last run
+		log.Printf("⚠️ Failed to listen on %v: %v, falling back to random ports", listenAddrs, err)
+		listenAddrs = withRandomPorts(listenAddrs)
+		h, err = newHost(identityMgr, listenAddrs, cfg.Limits, hostOpts)
+	}
 	if err != nil {
 		cancel()
 		return nil, fmt.Errorf("failed to create libp2p host: %w", err)
@@ -93,58 +271,155 @@ func New(ctx context.Context, identityMgr *identity.Manager) (*Manager, error) {
 
 	log.Printf("Libp2p host created with ID: %s", h.ID().String())
 
-	// Create DHT
-	kademliaDHT, err := dht.New(netCtx, h)
+	manager := newManager(netCtx, cancel, h, identityMgr, gater, addressBook, bandwidth)
+	manager.mode = mode
+	manager.natEnabled = mode == ModeInternet
+	manager.builtinDiscovery = true
+	manager.workspaces = workspaces
+	manager.dhtEnabled = cfg.DHT.Mode != DHTModeOff
+	manager.dhtOpts = dhtOpts
+	manager.dhtProtocol = dhtProtocol(cfg.DHT)
+	manager.rendezvousPoints = rendezvousPoints
+	manager.pexEnabled = cfg.PEX.Enabled
+	if cfg.PEX.MaxPeers > 0 {
+		manager.pexMaxPeers = cfg.PEX.MaxPeers
+	}
+	manager.listenAddrs = listenAddrs
+	manager.bootstrapPeers = bootstrapPeers
+	manager.pskFingerprint = pskFingerprint
+
+	if cfg.DHT.Private {
+		log.Printf("Using private DHT with protocol prefix %s", PrivateDHTPrefix)
+	}
+	for _, workspace := range workspaces {
+		log.Printf("📁 Joined workspace %s (namespace %s)", workspace.Name, workspace.Namespace())
+	}
+	if len(relays) > 0 && manager.natEnabled {
+		log.Printf("Using %d static circuit relays", len(relays))
+	}
+	if cfg.Relay.Service && manager.natEnabled {
+		manager.forcedPublic = true
+		log.Printf("🌐 Running a circuit relay service for other peers")
+	}
+	if cfg.Rendezvous.Service {
+		manager.rendezvous = newRendezvousServer()
+		h.SetStreamHandler(RendezvousProtocol, manager.handleRendezvousStream)
+		log.Printf("🌐 Running a rendezvous point for other peers")
+	}
+	if !cfg.PEX.Enabled {
+		h.RemoveStreamHandler(PEXProtocol)
+	}
+	if gater.getMode() != AccessOpen {
+		log.Printf("🔒 Access mode: %s", gater.getMode())
+	}
+
+	return manager, nil
+}
+
+// newHost creates a libp2p host listening on the given addresses. Each host gets
+// its own resource and connection managers, since closing a host closes them too.
+func newHost(identityMgr *identity.Manager, listenAddrs []multiaddr.Multiaddr, limits config.LimitsConfig, extraOpts []libp2p.Option) (host.Host, error) {
+	rm, err := resourceManager(limits)
 	if err != nil {
-		cancel()
-		h.Close()
-		return nil, fmt.Errorf("failed to create DHT: %w", err)
+		return nil, err
+	}
+	cm, err := connManager(limits)
+	if err != nil {
+		rm.Close()
+		return nil, err
+	}
+
+	opts := []libp2p.Option{
+		libp2p.Identity(identityMgr.GetPrivateKey()),
+		libp2p.ListenAddrs(listenAddrs...),
+		libp2p.ResourceManager(rm),
+		libp2p.ConnectionManager(cm),
+	}
+	opts = append(opts, extraOpts...)
+
+	h, err := libp2p.New(opts...)
+	if err != nil {
+		rm.Close()
+		cm.Close()
+		return nil, err
+	}
+	return h, nil
+}
+
+// NewWithHost creates a network manager on an existing libp2p host.
+// It runs in manual mode, so peers must be connected explicitly. In other modes only the
+// backends added with AddDiscoverer run, as the host may not be on a real network. The host
+// has no connection gater, so blocking a peer only closes its current connections.
+func NewWithHost(ctx context.Context, identityMgr *identity.Manager, h host.Host) (*Manager, error) {
+	if h.ID() != identityMgr.GetPeerID() {
+		return nil, fmt.Errorf("host ID %s does not match identity %s", h.ID(), identityMgr.GetPeerID())
+	}
+
+	access, err := NewAccessList("")
+	if err != nil {
+		return nil, err
+	}
+	gater, err := newConnectionGater(access, AccessOpen, nil)
+	if err != nil {
+		return nil, err
+	}
+	addressBook, err := NewAddressBook("")
+	if err != nil {
+		return nil, err
 	}
 
-	// Create routing discovery
-	routingDisc := routing.NewRoutingDiscovery(kademliaDHT)
+	netCtx, cancel := context.WithCancel(ctx)
+	manager := newManager(netCtx, cancel, h, identityMgr, gater, addressBook, nil)
+	manager.mode = ModeManual
+	return manager, nil
+}
 
+// newManager wires a manager to its host without starting any discovery
+func newManager(ctx context.Context, cancel context.CancelFunc, h host.Host, identityMgr *identity.Manager, gater *connectionGater, addressBook *AddressBook, bandwidth *metrics.BandwidthCounter) *Manager {
 	manager := &Manager{
 		host:          h,
-		dht:           kademliaDHT,
-		routingDisc:   routingDisc,
 		identity:      identityMgr,
-		ctx:           netCtx,
+		ctx:           ctx,
 		cancel:        cancel,
 		peers:         make(map[peer.ID]*Peer),
-		eventHandlers: make(map[string][]NetworkEventHandler),
-		listenAddrs:   listenAddrs,
+		events:        newEventBus(ctx),
+		eventHandlers: make(map[string][]func()),
+		gater:         gater,
+		addressBook:   addressBook,
+		bandwidth:     bandwidth,
+		reconnects:    make(map[peer.ID]*reconnectState),
+		hellos:        make(map[peer.ID]chan struct{}),
+		announced:     make(map[peer.ID]bool),
+		awaiting:      make(map[peer.ID]bool),
+		pexEnabled:    true,
+		pexMaxPeers:   defaultPEXMaxPeers,
 	}
+	gater.setAskHandler(manager.notifyContactRequest)
 
 	// Set up connection event handlers
 	h.Network().Notify((*networkNotifiee)(manager))
 
 	// Set up stream handlers
-	h.SetStreamHandler(ChatProtocol, manager.handleChatStream)
-	h.SetStreamHandler(TransferProtocol, manager.handleTransferStream)
+	h.SetStreamHandler(HelloProtocol, manager.handleHelloStream)
+	manager.setMessageHandlers()
+	h.SetStreamHandler(PEXProtocol, manager.handlePEXStream)
+	h.SetStreamHandler(InviteProtocol, manager.handleInviteStream)
 
-	return manager, nil
+	// Remember Shario peers once identify tells us their protocols and addresses
+	go manager.watchIdentify()
+	go manager.watchReachability()
+	go manager.qualityLoop()
+
+	return manager
 }
 
 // Start initializes the network manager and starts discovery
 func (m *Manager) Start() error {
 	log.Println("Starting network manager...")
 
-	// Bootstrap DHT
-	if err := m.dht.Bootstrap(m.ctx); err != nil {
-		return fmt.Errorf("failed to bootstrap DHT: %w", err)
-	}
-
-	// Start mDNS discovery
-	if err := m.startMDNSDiscovery(); err != nil {
-		log.Printf("Failed to start mDNS discovery: %v", err)
-	}
-
-	// Start DHT discovery
-	go m.startDHTDiscovery()
-
-	// Announce ourselves
-	go m.announcePresence()
+	m.modeMutex.Lock()
+	m.startDiscovery()
+	m.modeMutex.Unlock()
 
 	log.Printf("Network manager started. Listening on:")
 	for _, addr := range m.host.Addrs() {
@@ -154,135 +429,15 @@ func (m *Manager) Start() error {
 	return nil
 }
 
-// startMDNSDiscovery starts local network peer discovery using mDNS
-func (m *Manager) startMDNSDiscovery() error {
-	log.Printf("Starting mDNS discovery with service tag: '%s'", ServiceTag)
-	log.Printf("Host ID: %s", m.host.ID().String())
-	log.Printf("Host addresses:")
-	for _, addr := range m.host.Addrs() {
-		log.Printf("  %s", addr.String())
-	}
-
-	notifiee := &discoveryNotifiee{manager: m}
-	service := mdns.NewMdnsService(m.host, ServiceTag, notifiee)
-	if err := service.Start(); err != nil {
-		log.Printf("Warning: mDNS discovery failed to start: %v", err)
-		log.Printf("You may not be able to discover peers on the local network")
-		return nil // Don't fail the whole app if mDNS fails
-	}
-
-	m.discovery = service
-	log.Printf("mDNS discovery service started successfully")
-
-	// Add periodic check to see if mDNS is working
-	go func() {
-		ticker := time.NewTicker(15 * time.Second)
-		defer ticker.Stop()
-		checks := 0
-
-		for {
-			select {
-			case <-m.ctx.Done():
-				return
-			case <-ticker.C:
-				checks++
-				peerCount := len(m.peers)
-				log.Printf("mDNS check #%d: %d peers discovered so far", checks, peerCount)
-				if checks >= 4 && peerCount == 0 {
-					log.Printf("Warning: No peers discovered after %d seconds. Try manual connection.", checks*15)
-				}
-			}
-		}
-	}()
-
-	return nil
-}
-
-// startDHTDiscovery starts DHT-based peer discovery
-func (m *Manager) startDHTDiscovery() {
-	log.Println("Starting DHT discovery...")
-
-	// Initial discovery attempt
-	go func() {
-		if _, err := m.routingDisc.Advertise(m.ctx, ServiceTag); err != nil {
-			log.Printf("DHT advertising not available yet: %v (this is normal for the first instance)", err)
-		} else {
-			log.Printf("Successfully advertised service '%s' on DHT", ServiceTag)
-		}
-	}()
-
-	ticker := time.NewTicker(5 * time.Second)
-	defer ticker.Stop()
-
-	discoveryCount := 0
-
-	for {
-		select {
-		case <-m.ctx.Done():
-			return
-		case <-ticker.C:
-			discoveryCount++
-			log.Printf("DHT discovery attempt #%d", discoveryCount)
-
-			peerChan, err := m.routingDisc.FindPeers(m.ctx, ServiceTag)
-			if err != nil {
-				log.Printf("Failed to find peers via DHT: %v", err)
-				continue
-			}
-
-			go func() {
-				peersFound := 0
-				for peerInfo := range peerChan {
-					if peerInfo.ID == m.host.ID() {
-						continue
-					}
-
-					peersFound++
-					log.Printf("Found peer via DHT: %s", peerInfo.ID)
-
-					if err := m.host.Connect(m.ctx, peerInfo); err != nil {
-						log.Printf("Failed to connect to DHT peer %s: %v", peerInfo.ID, err)
-					} else {
-						log.Printf("Successfully connected to DHT peer: %s", peerInfo.ID)
-					}
-				}
-
-				if peersFound == 0 {
-					log.Printf("No peers found via DHT in attempt #%d", discoveryCount)
-				}
-			}()
-		}
-	}
-}
-
-// announcePresence announces our presence on the network
-func (m *Manager) announcePresence() {
-	ticker := time.NewTicker(10 * time.Second)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-m.ctx.Done():
-			return
-		case <-ticker.C:
-			if _, err := m.routingDisc.Advertise(m.ctx, ServiceTag); err != nil {
-				// Only log this if we have peers in the DHT table
-				if m.dht.RoutingTable().Size() > 0 {
-					log.Printf("Failed to advertise presence: %v", err)
-				}
-			}
-		}
-	}
-}
-
-// GetPeers returns a list of connected peers
+// GetPeers returns copies of the connected peers, safe to read while the peers are updated
 func (m *Manager) GetPeers() []*Peer {
 	m.peersMutex.RLock()
 	defer m.peersMutex.RUnlock()
 
 	peers := make([]*Peer, 0, len(m.peers))
-	for _, peer := range m.peers {
-		peers = append(peers, peer)
+	for _, p := range m.peers {
+		info := copyPeer(p)
+		peers = append(peers, &info)
 	}
 
 	return peers
@@ -295,19 +450,81 @@ func (m *Manager) GetPeerCount() int {
 	return len(m.peers)
 }
 
+// FlagPeer marks a connected peer as misbehaving so the UI can highlight it
+func (m *Manager) FlagPeer(peerID peer.ID, reason string) {
+	m.peersMutex.Lock()
+	defer m.peersMutex.Unlock()
+
+	if p, exists := m.peers[peerID]; exists {
+		p.Flagged = true
+		p.FlagReason = reason
+		log.Printf("Flagged peer %s: %s", peerID.String(), reason)
+	}
+}
+
+// MarkLeaving records that a connected peer said it is shutting down, so the event of its
+// disconnect reports that it left. Leaves of peers that are already gone are ignored.
+func (m *Manager) MarkLeaving(peerID peer.ID) {
+	m.peersMutex.Lock()
+	defer m.peersMutex.Unlock()
+
+	if p, exists := m.peers[peerID]; exists {
+		p.leaving = true
+	}
+}
+
+// SetPeerNickname updates the nickname of a connected peer and remembers it in the address book
+func (m *Manager) SetPeerNickname(peerID peer.ID, nickname string) {
+	m.peersMutex.Lock()
+	if p, exists := m.peers[peerID]; exists {
+		p.Nickname = nickname
+	}
+	m.peersMutex.Unlock()
+
+	if err := m.addressBook.SetNickname(peerID, nickname); err != nil {
+		log.Printf("Failed to save address book: %v", err)
+	}
+}
+
 // GetHost returns the libp2p host
 func (m *Manager) GetHost() host.Host {
 	return m.host
 }
 
-// GetDHT returns the DHT instance
+// Connect dials a peer, explaining failures caused by the access lists or a mismatched pre-shared key
+func (m *Manager) Connect(ctx context.Context, info peer.AddrInfo) error {
+	if reason := m.gater.refusal(info); reason != "" {
+		return fmt.Errorf("refusing to connect to %s: %s", info.ID, reason)
+	}
+	return m.explainDialError(m.host.Connect(ctx, info))
+}
+
+// PrivateNetworkFingerprint returns the fingerprint of the pre-shared key, or "" on the public network
+func (m *Manager) PrivateNetworkFingerprint() string {
+	return m.pskFingerprint
+}
+
+// ListenAddrs returns the addresses the host is listening on, with assigned ports filled in
+func (m *Manager) ListenAddrs() []multiaddr.Multiaddr {
+	return m.host.Network().ListenAddresses()
+}
+
+// GetDHT returns the DHT instance, or nil when the network mode runs without it
 func (m *Manager) GetDHT() *dht.IpfsDHT {
-	return m.dht
+	m.modeMutex.Lock()
+	defer m.modeMutex.Unlock()
+
+	for _, d := range m.discoverers {
+		if kad, ok := d.(*dhtDiscoverer); ok {
+			return kad.dht
+		}
+	}
+	return nil
 }
 
-// SendMessage sends a message to a peer using the specified protocol
+// SendMessage sends a message to a peer using the newest version of the protocol both sides speak
 func (m *Manager) SendMessage(peerID peer.ID, protocol protocol.ID, data []byte) error {
-	stream, err := m.host.NewStream(m.ctx, peerID, protocol)
+	stream, err := m.host.NewStream(m.ctx, peerID, ProtocolVersions(protocol)...)
 	if err != nil {
 		return fmt.Errorf("failed to create stream to peer %s: %w", peerID, err)
 	}
@@ -320,104 +537,81 @@ func (m *Manager) SendMessage(peerID peer.ID, protocol protocol.ID, data []byte)
 	return nil
 }
 
-// AddEventHandler adds a network event handler
+// AddEventHandler subscribes a network event handler to all events under a name
 func (m *Manager) AddEventHandler(name string, handler NetworkEventHandler) {
+	unsubscribes := []func(){
+		m.SubscribePeers(
+			func(e PeerConnectedEvent) { handler.OnPeerConnected(&e.Peer) },
+			func(e PeerDisconnectedEvent) { handler.OnPeerDisconnected(e.PeerID) },
+		),
+		m.SubscribeMessages("", func(e MessageEvent) { handler.OnMessage(e.PeerID, e.Protocol, e.Data) }),
+	}
+
 	m.handlersMutex.Lock()
 	defer m.handlersMutex.Unlock()
-
-	if m.eventHandlers[name] == nil {
-		m.eventHandlers[name] = make([]NetworkEventHandler, 0)
-	}
-	m.eventHandlers[name] = append(m.eventHandlers[name], handler)
+	m.eventHandlers[name] = append(m.eventHandlers[name], unsubscribes...)
 }
 
-// RemoveEventHandler removes a network event handler
+// RemoveEventHandler unsubscribes the network event handlers added under a name
 func (m *Manager) RemoveEventHandler(name string) {
 	m.handlersMutex.Lock()
-	defer m.handlersMutex.Unlock()
-
+	unsubscribes := m.eventHandlers[name]
 	delete(m.eventHandlers, name)
-}
-
-// notifyPeerConnected notifies all event handlers of a peer connection
-func (m *Manager) notifyPeerConnected(peer *Peer) {
-	m.handlersMutex.RLock()
-	defer m.handlersMutex.RUnlock()
+	m.handlersMutex.Unlock()
 
-	for _, handlers := range m.eventHandlers {
-		for _, handler := range handlers {
-			go handler.OnPeerConnected(peer)
-		}
+	for _, unsubscribe := range unsubscribes {
+		unsubscribe()
 	}
 }
 
-// notifyPeerDisconnected notifies all event handlers of a peer disconnection
-func (m *Manager) notifyPeerDisconnected(peerID peer.ID) {
-	m.handlersMutex.RLock()
-	defer m.handlersMutex.RUnlock()
-
-	for _, handlers := range m.eventHandlers {
-		for _, handler := range handlers {
-			go handler.OnPeerDisconnected(peerID)
-		}
-	}
+// notifyPeerConnected publishes a peer connection
+func (m *Manager) notifyPeerConnected(info Peer) {
+	m.events.publish(eventKey{peer: info.PeerID}, PeerConnectedEvent{Peer: info})
 }
 
-// notifyMessage notifies all event handlers of a received message
-func (m *Manager) notifyMessage(peerID peer.ID, protocol protocol.ID, data []byte) {
-	m.handlersMutex.RLock()
-	defer m.handlersMutex.RUnlock()
-
-	for _, handlers := range m.eventHandlers {
-		for _, handler := range handlers {
-			go handler.OnMessage(peerID, protocol, data)
-		}
-	}
+// notifyPeerUpdated publishes a profile received from an announced peer
+func (m *Manager) notifyPeerUpdated(info Peer) {
+	m.events.publish(eventKey{peer: info.PeerID}, PeerUpdatedEvent{Peer: info})
 }
 
-// handleChatStream handles incoming chat streams
-func (m *Manager) handleChatStream(stream network.Stream) {
-	defer stream.Close()
-
-	// Read message data
-	buf := make([]byte, 4096)
-	n, err := stream.Read(buf)
-	if err != nil {
-		log.Printf("Failed to read chat message: %v", err)
-		return
-	}
-
-	// Notify handlers
-	m.notifyMessage(stream.Conn().RemotePeer(), ChatProtocol, buf[:n])
+// notifyPeerDisconnected publishes a peer disconnection
+func (m *Manager) notifyPeerDisconnected(peerID peer.ID, left bool) {
+	m.events.publish(eventKey{peer: peerID}, PeerDisconnectedEvent{PeerID: peerID, Left: left})
 }
 
-// handleTransferStream handles incoming file transfer streams
-func (m *Manager) handleTransferStream(stream network.Stream) {
-	defer stream.Close()
+// notifyMessage publishes a received message, blocking while the subscribers fall behind
+func (m *Manager) notifyMessage(peerID peer.ID, protocol, version protocol.ID, data []byte) {
+	m.events.publish(eventKey{peer: peerID, protocol: protocol}, MessageEvent{PeerID: peerID, Protocol: protocol, Version: version, Data: data})
+}
 
-	// Read transfer data
-	buf := make([]byte, 4096)
-	n, err := stream.Read(buf)
+// readMessage reads a whole message, which the sender delimits by closing the stream
+func readMessage(stream network.Stream) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(stream, MaxMessageSize+1))
 	if err != nil {
-		log.Printf("Failed to read transfer message: %v", err)
-		return
+		return nil, err
 	}
-
-	// Notify handlers
-	m.notifyMessage(stream.Conn().RemotePeer(), TransferProtocol, buf[:n])
+	if len(data) > MaxMessageSize {
+		stream.Reset()
+		return nil, fmt.Errorf("message exceeds %d bytes", MaxMessageSize)
+	}
+	if len(data) == 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return data, nil
 }
 
-// Close shuts down the network manager
+// Close records the connected peers in the address book, stops discovery and closes the host
 func (m *Manager) Close() error {
-	m.cancel()
-
-	if m.discovery != nil {
-		m.discovery.Close()
+	// Remember when connected peers were last seen so the next start redials them
+	for _, peerID := range m.host.Network().Peers() {
+		m.rememberPeer(peerID)
 	}
 
-	if m.dht != nil {
-		m.dht.Close()
-	}
+	m.cancel()
+
+	m.modeMutex.Lock()
+	m.stopDiscovery()
+	m.modeMutex.Unlock()
 
 	return m.host.Close()
 }
@@ -0,0 +1,620 @@
+package network_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"shario/internal/config"
+	"shario/internal/identity"
+	"shario/internal/network"
+	"shario/internal/network/nettest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	libp2pnetwork "github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+const waitTimeout = 10 * time.Second
+
+// Event names recorded for each peer
+const (
+	connected    = "connected"
+	disconnected = "disconnected"
+)
+
+func TestMain(m *testing.M) {
+	// The managers log every connection, which drowns test output
+	if os.Getenv("SHARIO_TEST_LOG") == "" {
+		log.SetOutput(io.Discard)
+	}
+	os.Exit(m.Run())
+}
+
+// recorder collects the connection events a manager publishes for each peer. Events of one
+// peer arrive in order, events of different peers may interleave.
+type recorder struct {
+	mutex  sync.Mutex
+	events map[peer.ID][]string
+}
+
+func newRecorder(node *nettest.Node) *recorder {
+	r := &recorder{events: make(map[peer.ID][]string)}
+	node.Network.AddEventHandler("test", r)
+	return r
+}
+
+// OnPeerConnected records a connection
+func (r *recorder) OnPeerConnected(p *network.Peer) {
+	r.record(p.PeerID, connected)
+}
+
+// OnPeerDisconnected records a disconnection
+func (r *recorder) OnPeerDisconnected(peerID peer.ID) {
+	r.record(peerID, disconnected)
+}
+
+// OnMessage ignores protocol messages
+func (r *recorder) OnMessage(peerID peer.ID, protocol protocol.ID, data []byte) {}
+
+func (r *recorder) record(peerID peer.ID, event string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.events[peerID] = append(r.events[peerID], event)
+}
+
+// sequence returns the events recorded for a peer
+func (r *recorder) sequence(peerID peer.ID) []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]string(nil), r.events[peerID]...)
+}
+
+// expect waits until a peer has as many events as wanted and checks that the sequence is
+// exactly the wanted one. Events of a peer arrive in order, so an unwanted event shows up
+// at the latest when the next expected one does, which is why tests end on a disconnection.
+func (r *recorder) expect(t *testing.T, who string, peerID peer.ID, want ...string) {
+	t.Helper()
+
+	nettest.WaitFor(t, waitTimeout, func() bool {
+		return len(r.sequence(peerID)) >= len(want)
+	}, "%s: expected events %v, got %v", who, want, r.sequence(peerID))
+
+	if got := r.sequence(peerID); !reflect.DeepEqual(got, want) {
+		t.Fatalf("%s: expected events %v, got %v", who, want, got)
+	}
+}
+
+// waitLast waits until the latest event recorded for a peer is the given one
+func waitLast(t *testing.T, who string, r *recorder, peerID peer.ID, event string) {
+	t.Helper()
+
+	nettest.WaitFor(t, waitTimeout, func() bool {
+		seq := r.sequence(peerID)
+		return len(seq) > 0 && seq[len(seq)-1] == event
+	}, "%s: expected %s as the latest event, got %v", who, event, r.sequence(peerID))
+}
+
+// peerIDs returns the sorted IDs in a manager's peer map
+func peerIDs(networkMgr *network.Manager) []string {
+	var ids []string
+	for _, p := range networkMgr.GetPeers() {
+		ids = append(ids, p.PeerID.String())
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// assertPeers checks that a manager's peer map holds exactly the given nodes
+func assertPeers(t *testing.T, who string, networkMgr *network.Manager, nodes ...*nettest.Node) {
+	t.Helper()
+
+	want := []string{}
+	for _, node := range nodes {
+		want = append(want, node.ID().String())
+	}
+	sort.Strings(want)
+
+	got := peerIDs(networkMgr)
+	if got == nil {
+		got = []string{}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("%s: expected peers %v, got %v", who, want, got)
+	}
+}
+
+// waitPeerCount waits until a manager tracks exactly n peers
+func waitPeerCount(t *testing.T, who string, networkMgr *network.Manager, n int) {
+	t.Helper()
+
+	nettest.WaitFor(t, waitTimeout, func() bool {
+		return networkMgr.GetPeerCount() == n
+	}, "%s: expected %d peers, got %v", who, n, peerIDs(networkMgr))
+}
+
+func TestDiscoveryConnectsAllNodes(t *testing.T) {
+	mesh := nettest.New(t, 3)
+	recorders := make([]*recorder, len(mesh.Nodes))
+	for i, node := range mesh.Nodes {
+		recorders[i] = newRecorder(node)
+	}
+
+	mesh.Discover(t, 0, 1, 2)
+
+	for _, node := range mesh.Nodes {
+		waitPeerCount(t, node.Identity.GetNickname(), node.Network, 2)
+	}
+	for i, node := range mesh.Nodes {
+		var others []*nettest.Node
+		for j, other := range mesh.Nodes {
+			if j != i {
+				others = append(others, other)
+				recorders[i].expect(t, node.Identity.GetNickname(), other.ID(), connected)
+			}
+		}
+		assertPeers(t, node.Identity.GetNickname(), node.Network, others...)
+	}
+
+	// Each node announced every other one exactly once before losing it
+	for i := range mesh.Nodes {
+		for j := i + 1; j < len(mesh.Nodes); j++ {
+			mesh.Disconnect(t, i, j)
+		}
+	}
+	for i, node := range mesh.Nodes {
+		for j, other := range mesh.Nodes {
+			if j != i {
+				recorders[i].expect(t, node.Identity.GetNickname(), other.ID(), connected, disconnected)
+			}
+		}
+	}
+}
+
+func TestDiscoveryRespectsManualMode(t *testing.T) {
+	mesh := nettest.New(t, 2)
+	recorder := newRecorder(mesh.Nodes[0])
+
+	mesh.Discover(t, 0, 1)
+	waitPeerCount(t, "node0", mesh.Nodes[0].Network, 1)
+	recorder.expect(t, "node0", mesh.Nodes[1].ID(), connected)
+
+	// Back in manual mode the discoverer is stopped and reports nothing
+	if err := mesh.Nodes[0].Network.SetNetworkMode(network.ModeManual); err != nil {
+		t.Fatalf("failed to switch to manual mode: %v", err)
+	}
+	mesh.Disconnect(t, 0, 1)
+	recorder.expect(t, "node0", mesh.Nodes[1].ID(), connected, disconnected)
+
+	if mesh.Nodes[0].Discoverer.Find(mesh.Nodes[1].Host.Peerstore().PeerInfo(mesh.Nodes[1].ID())) {
+		t.Fatalf("node0: stopped discoverer still reports peers")
+	}
+	assertPeers(t, "node0", mesh.Nodes[0].Network)
+}
+
+func TestDuplicateConnections(t *testing.T) {
+	mesh := nettest.New(t, 2)
+	a, b := mesh.Nodes[0], mesh.Nodes[1]
+	recorderA, recorderB := newRecorder(a), newRecorder(b)
+
+	// Both sides discover each other at once and keep reporting and dialing the other,
+	// as mDNS on a busy network does
+	mesh.Discover(t, 0, 1)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			a.Discoverer.Find(peer.AddrInfo{ID: b.ID(), Addrs: b.Host.Addrs()})
+			if _, err := mesh.Mocknet.ConnectPeers(a.ID(), b.ID()); err != nil {
+				t.Errorf("node0 failed to dial node1: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			b.Discoverer.Find(peer.AddrInfo{ID: a.ID(), Addrs: a.Host.Addrs()})
+			if _, err := mesh.Mocknet.ConnectPeers(b.ID(), a.ID()); err != nil {
+				t.Errorf("node1 failed to dial node0: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if t.Failed() {
+		t.FailNow()
+	}
+
+	// Each side lists the other once and announces it once
+	recorderA.expect(t, "node0", b.ID(), connected)
+	recorderB.expect(t, "node1", a.ID(), connected)
+	assertPeers(t, "node0", a.Network, b)
+	assertPeers(t, "node1", b.Network, a)
+
+	// Closing every connection announces a single disconnection
+	mesh.Disconnect(t, 0, 1)
+	recorderA.expect(t, "node0", b.ID(), connected, disconnected)
+	recorderB.expect(t, "node1", a.ID(), connected, disconnected)
+	assertPeers(t, "node0", a.Network)
+	assertPeers(t, "node1", b.Network)
+}
+
+func TestLinkDropAndRediscovery(t *testing.T) {
+	mesh := nettest.New(t, 3)
+	a, b, c := mesh.Nodes[0], mesh.Nodes[1], mesh.Nodes[2]
+	recorderA := newRecorder(a)
+
+	mesh.Discover(t, 0, 1, 2)
+	recorderA.expect(t, "node0", b.ID(), connected)
+	recorderA.expect(t, "node0", c.ID(), connected)
+
+	// Only the dropped link loses its peer
+	mesh.Unlink(t, 0, 1)
+	recorderA.expect(t, "node0", b.ID(), connected, disconnected)
+	recorderA.expect(t, "node0", c.ID(), connected)
+	assertPeers(t, "node0", a.Network, c)
+
+	// Dialing the peer while the link is down fails and changes nothing
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+	if err := a.Network.Connect(ctx, peer.AddrInfo{ID: b.ID(), Addrs: b.Host.Addrs()}); err == nil {
+		t.Fatalf("node0: connected to node1 over a dropped link")
+	}
+	recorderA.expect(t, "node0", b.ID(), connected, disconnected)
+	assertPeers(t, "node0", a.Network, c)
+
+	// Once the link is back, rediscovering the peer reconnects it
+	mesh.Link(t, 0, 1)
+	a.Discoverer.Find(peer.AddrInfo{ID: b.ID(), Addrs: b.Host.Addrs()})
+	recorderA.expect(t, "node0", b.ID(), connected, disconnected, connected)
+	assertPeers(t, "node0", a.Network, b, c)
+	waitPeerCount(t, "node1", b.Network, 2)
+}
+
+func TestRepeatedReconnects(t *testing.T) {
+	mesh := nettest.New(t, 2)
+	a, b := mesh.Nodes[0], mesh.Nodes[1]
+	recorderA, recorderB := newRecorder(a), newRecorder(b)
+
+	var want []string
+	for i := 0; i < 5; i++ {
+		mesh.Connect(t, 0, 1)
+		want = append(want, connected)
+		recorderA.expect(t, "node0", b.ID(), want...)
+
+		mesh.Disconnect(t, 0, 1)
+		want = append(want, disconnected)
+		recorderA.expect(t, "node0", b.ID(), want...)
+		recorderB.expect(t, "node1", a.ID(), want...)
+		assertPeers(t, "node0", a.Network)
+		assertPeers(t, "node1", b.Network)
+	}
+}
+
+func TestNonSharioPeerIsNotListed(t *testing.T) {
+	mesh := nettest.New(t, 2)
+	node := mesh.Nodes[0]
+	recorder := newRecorder(node)
+
+	// A plain libp2p host such as a DHT server speaks none of our protocols
+	other, err := mesh.Mocknet.GenPeer()
+	if err != nil {
+		t.Fatalf("failed to create plain host: %v", err)
+	}
+	if err := mesh.Mocknet.LinkAll(); err != nil {
+		t.Fatalf("failed to link plain host: %v", err)
+	}
+	if _, err := mesh.Mocknet.ConnectPeers(other.ID(), node.ID()); err != nil {
+		t.Fatalf("failed to connect plain host: %v", err)
+	}
+
+	nettest.WaitFor(t, waitTimeout, func() bool {
+		protocols, err := node.Host.Peerstore().GetProtocols(other.ID())
+		return err == nil && len(protocols) > 0
+	}, "identify with the plain host did not complete")
+
+	// Identify results are handled in order, so once a Shario peer identified later is
+	// listed, the plain host has been looked at and left out
+	mesh.Connect(t, 0, 1)
+	assertPeers(t, "node0", node.Network, mesh.Nodes[1])
+
+	// Only listed peers are announced, so closing the plain host announces nothing either
+	if err := other.Close(); err != nil {
+		t.Fatalf("failed to close plain host: %v", err)
+	}
+	nettest.WaitFor(t, waitTimeout, func() bool {
+		return node.Host.Network().Connectedness(other.ID()) != libp2pnetwork.Connected
+	}, "node0 is still connected to the plain host")
+	if got := recorder.sequence(other.ID()); len(got) != 0 {
+		t.Fatalf("expected no events for a plain host, got %v", got)
+	}
+}
+
+func TestConnectionChurnKeepsEventOrder(t *testing.T) {
+	mesh := nettest.New(t, 2)
+	a, b := mesh.Nodes[0], mesh.Nodes[1]
+	recorderA, recorderB := newRecorder(a), newRecorder(b)
+
+	// Dropping connections at varying points of the hello exchange must never
+	// announce a disconnection without the connection before it
+	for i := 0; i < 30; i++ {
+		if _, err := mesh.Mocknet.ConnectPeers(a.ID(), b.ID()); err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+		time.Sleep(time.Duration(i%8) * time.Millisecond)
+		mesh.Disconnect(t, 0, 1)
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	waitPeerCount(t, "node0", a.Network, 0)
+	waitPeerCount(t, "node1", b.Network, 0)
+
+	// A last connection and disconnection come after every earlier event of the peer
+	mesh.Connect(t, 0, 1)
+	waitLast(t, "node0", recorderA, b.ID(), connected)
+	waitLast(t, "node1", recorderB, a.ID(), connected)
+	mesh.Disconnect(t, 0, 1)
+	waitLast(t, "node0", recorderA, b.ID(), disconnected)
+	waitLast(t, "node1", recorderB, a.ID(), disconnected)
+
+	for who, seq := range map[string][]string{
+		"node0": recorderA.sequence(b.ID()),
+		"node1": recorderB.sequence(a.ID()),
+	} {
+		if len(seq)%2 != 0 {
+			t.Fatalf("%s: expected pairs of events, got %v", who, seq)
+		}
+		for i, event := range seq {
+			if want := []string{connected, disconnected}[i%2]; event != want {
+				t.Fatalf("%s: expected %s at event %d, got %v", who, want, i, seq)
+			}
+		}
+	}
+}
+
+func TestConnectedEventIsACopy(t *testing.T) {
+	mesh := nettest.New(t, 2)
+	a, b := mesh.Nodes[0], mesh.Nodes[1]
+
+	// The subscriber reads the announced peer while the manager keeps updating its entry,
+	// which the race detector reports unless the event carries a copy
+	nicknames := make(chan string, 1)
+	unsubscribe := a.Network.SubscribePeerConnected(func(event network.PeerConnectedEvent) {
+		var nickname string
+		for i := 0; i < 1000; i++ {
+			nickname = event.Peer.Nickname
+		}
+		nicknames <- nickname
+	})
+	defer unsubscribe()
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				a.Network.SetPeerNickname(b.ID(), "renamed")
+			}
+		}
+	}()
+
+	mesh.Connect(t, 0, 1)
+
+	select {
+	case <-nicknames:
+	case <-time.After(waitTimeout):
+		t.Fatalf("node0 did not announce node1")
+	}
+	close(done)
+	wg.Wait()
+}
+
+func TestLeaveAfterDisconnectIsNotCarriedOver(t *testing.T) {
+	mesh := nettest.New(t, 2)
+	a, b := mesh.Nodes[0], mesh.Nodes[1]
+	recorderA := newRecorder(a)
+
+	left := make(chan bool, 3)
+	unsubscribe := a.Network.SubscribePeerDisconnected(func(event network.PeerDisconnectedEvent) {
+		left <- event.Left
+	})
+	defer unsubscribe()
+
+	waitLeft := func(want bool) {
+		t.Helper()
+		select {
+		case got := <-left:
+			if got != want {
+				t.Fatalf("node0: disconnect of node1 reported left=%v, want %v", got, want)
+			}
+		case <-time.After(waitTimeout):
+			t.Fatalf("node0: no disconnect event for node1")
+		}
+	}
+
+	// A leave handled after the disconnect must not label the next disconnect
+	mesh.Connect(t, 0, 1)
+	recorderA.expect(t, "node0", b.ID(), connected)
+	mesh.Disconnect(t, 0, 1)
+	waitLeft(false)
+	a.Network.MarkLeaving(b.ID())
+
+	mesh.Connect(t, 0, 1)
+	recorderA.expect(t, "node0", b.ID(), connected, disconnected, connected)
+	mesh.Disconnect(t, 0, 1)
+	waitLeft(false)
+
+	// A leave handled before the disconnect is reported with it
+	mesh.Connect(t, 0, 1)
+	recorderA.expect(t, "node0", b.ID(), connected, disconnected, connected, disconnected, connected)
+	a.Network.MarkLeaving(b.ID())
+	mesh.Disconnect(t, 0, 1)
+	waitLeft(true)
+}
+
+func TestSwitchFromInternetToLAN(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	cfg := config.Default().Network
+	cfg.Transports = []string{network.TransportTCP}
+	cfg.DHT.Mode = network.DHTModeOff
+
+	newManager := func(name string) *network.Manager {
+		identityMgr, err := identity.NewEphemeral(name)
+		if err != nil {
+			t.Fatalf("failed to create identity: %v", err)
+		}
+		networkMgr, err := network.New(context.Background(), identityMgr, cfg)
+		if err != nil {
+			t.Fatalf("failed to create network manager: %v", err)
+		}
+		t.Cleanup(func() { networkMgr.Close() })
+		return networkMgr
+	}
+	a, b := newManager("node0"), newManager("node1")
+
+	// NAT traversal runs in the default internet mode, LAN mode gates it without a restart
+	if err := a.SetNetworkMode(network.ModeLAN); err != nil {
+		t.Fatalf("switching to LAN mode failed: %v", err)
+	}
+
+	for _, addr := range a.GetHost().Addrs() {
+		if !manet.IsPrivateAddr(addr) {
+			t.Errorf("LAN mode announces %s", addr)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+
+	stranger, err := identity.NewEphemeral("stranger")
+	if err != nil {
+		t.Fatalf("failed to create identity: %v", err)
+	}
+	remote := peer.AddrInfo{ID: stranger.GetPeerID(), Addrs: []multiaddr.Multiaddr{multiaddr.StringCast("/ip4/203.0.113.7/tcp/4001")}}
+	if err := a.GetHost().Connect(ctx, remote); err == nil {
+		t.Errorf("LAN mode dialed a public address")
+	}
+
+	// Peers on the local network still connect
+	var port string
+	for _, addr := range b.GetHost().Network().ListenAddresses() {
+		if _, err := addr.ValueForProtocol(multiaddr.P_IP4); err != nil {
+			continue
+		}
+		if value, err := addr.ValueForProtocol(multiaddr.P_TCP); err == nil {
+			port = value
+		}
+	}
+	if port == "" {
+		t.Fatalf("node1 has no TCP listener")
+	}
+	local := peer.AddrInfo{ID: b.GetHost().ID(), Addrs: []multiaddr.Multiaddr{multiaddr.StringCast("/ip4/127.0.0.1/tcp/" + port)}}
+	if err := a.GetHost().Connect(ctx, local); err != nil {
+		t.Errorf("LAN mode refused a local peer: %v", err)
+	}
+}
+
+func TestInviteAdmitsInviteeInAllowlistMode(t *testing.T) {
+	mesh := nettest.New(t, 2)
+	inviter, invitee := mesh.Nodes[0], mesh.Nodes[1]
+	recorder := newRecorder(inviter)
+
+	if err := inviter.Network.SetAccessMode(network.AccessAllowlist); err != nil {
+		t.Fatalf("failed to switch to allowlist mode: %v", err)
+	}
+	invite, err := inviter.Network.CreateInvite("", time.Hour)
+	if err != nil {
+		t.Fatalf("CreateInvite failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+	if _, err := invitee.Network.AcceptInvite(ctx, invite.String()); err != nil {
+		t.Fatalf("AcceptInvite failed: %v", err)
+	}
+
+	// The inviter lets the invitee in, remembers it and still learns its profile
+	waitLast(t, "inviter", recorder, invitee.ID(), connected)
+	if allowed := inviter.Network.AllowedEntries(); !reflect.DeepEqual(allowed, []string{invitee.ID().String()}) {
+		t.Errorf("inviter allowlist = %v", allowed)
+	}
+	nettest.WaitFor(t, waitTimeout, func() bool {
+		info, exists := inviter.Network.GetPeerInfo(invitee.ID())
+		return exists && info.Nickname == "node1"
+	}, "inviter never received the invitee's profile")
+}
+
+// exchangedAddrs asks a node for its peer exchange answer and returns the addresses it shares of a peer
+func exchangedAddrs(t *testing.T, requester, node *nettest.Node, peerID peer.ID) []string {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+	stream, err := requester.Host.NewStream(ctx, node.ID(), network.PEXProtocol)
+	if err != nil {
+		t.Fatalf("failed to open peer exchange stream: %v", err)
+	}
+	defer stream.Close()
+
+	var response struct {
+		Peers []struct {
+			Peer  string   `json:"peer"`
+			Addrs []string `json:"addrs"`
+		} `json:"peers"`
+	}
+	if err := json.NewDecoder(stream).Decode(&response); err != nil {
+		t.Fatalf("failed to read peer exchange answer: %v", err)
+	}
+	for _, p := range response.Peers {
+		if p.Peer == peerID.String() {
+			return p.Addrs
+		}
+	}
+	return nil
+}
+
+func TestPeerExchangeLeavesOutRefusedAddrs(t *testing.T) {
+	mesh := nettest.New(t, 3)
+	a, b, c := mesh.Nodes[0], mesh.Nodes[1], mesh.Nodes[2]
+	mesh.Connect(t, 0, 1)
+	mesh.Connect(t, 0, 2)
+
+	// node0 also knows node2 under an address it blocked
+	a.Host.Peerstore().AddAddr(c.ID(), multiaddr.StringCast("/ip4/203.0.113.7/tcp/4001"), time.Hour)
+	if err := a.Network.Block("203.0.113.7"); err != nil {
+		t.Fatalf("Block failed: %v", err)
+	}
+	if addrs := exchangedAddrs(t, b, a, c.ID()); !reflect.DeepEqual(addrs, []string{"/ip4/10.0.0.3/tcp/4001"}) {
+		t.Errorf("node0 shared node2 as %v", addrs)
+	}
+
+	// In allowlist mode only the allowed addresses are shared
+	if err := a.Network.Unblock("203.0.113.7"); err != nil {
+		t.Fatalf("Unblock failed: %v", err)
+	}
+	for _, entry := range []string{b.ID().String(), "10.0.0.3"} {
+		if err := a.Network.Allow(entry); err != nil {
+			t.Fatalf("Allow failed: %v", err)
+		}
+	}
+	if err := a.Network.SetAccessMode(network.AccessAllowlist); err != nil {
+		t.Fatalf("failed to switch to allowlist mode: %v", err)
+	}
+	if addrs := exchangedAddrs(t, b, a, c.ID()); !reflect.DeepEqual(addrs, []string{"/ip4/10.0.0.3/tcp/4001"}) {
+		t.Errorf("node0 shared node2 as %v in allowlist mode", addrs)
+	}
+}
@@ -0,0 +1,119 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// Network modes deciding how peers are discovered
+const (
+	ModeLAN      = "lan"      // mDNS only, without the DHT, port mapping or relays
+	ModeInternet = "internet" // mDNS, the DHT, rendezvous points and peer exchange, with NAT traversal
+	ModeManual   = "manual"   // no discovery, peers are only connected explicitly
+)
+
+// ErrRestartRequired is returned when switching to internet mode on a host created without NAT
+// traversal. Discovery switches right away, port mapping, hole punching and relays after a restart.
+var ErrRestartRequired = errors.New("NAT traversal and relays only start after a restart")
+
+// validateNetworkMode checks that a configured network mode is known
+func validateNetworkMode(mode string) error {
+	switch mode {
+	case "", ModeLAN, ModeInternet, ModeManual:
+		return nil
+	default:
+		return fmt.Errorf("unknown network mode: %s", mode)
+	}
+}
+
+// NetworkMode returns the current network mode
+func (m *Manager) NetworkMode() string {
+	m.modeMutex.Lock()
+	defer m.modeMutex.Unlock()
+	return m.mode
+}
+
+// SetNetworkMode stops the discovery services of the current mode and starts those of the new one.
+// NAT traversal is set up when the host is created. LAN mode keeps it from reaching beyond the
+// local network, enabling it on a host created without it returns ErrRestartRequired.
+func (m *Manager) SetNetworkMode(mode string) error {
+	if err := validateNetworkMode(mode); err != nil {
+		return err
+	}
+	if mode == "" {
+		mode = ModeInternet
+	}
+
+	m.modeMutex.Lock()
+	defer m.modeMutex.Unlock()
+
+	if mode == m.mode {
+		return nil
+	}
+	m.mode = mode
+
+	// Mapped ports, relays and AutoNAT dial-backs all go through the gater, which refuses
+	// anything beyond the local network in LAN mode
+	m.gater.setLANOnly(mode == ModeLAN)
+	if mode == ModeLAN {
+		m.closeNonLANConns()
+	}
+
+	// Before Start the new mode only takes effect once discovery starts
+	if m.discoveryCancel != nil {
+		m.stopDiscovery()
+		m.startDiscovery()
+	}
+
+	if mode == ModeInternet && !m.natEnabled {
+		log.Printf("⚠️ NAT traversal and relays start with the internet mode after a restart")
+		return ErrRestartRequired
+	}
+	return nil
+}
+
+// closeNonLANConns closes the connections LAN mode no longer allows, including relayed ones
+func (m *Manager) closeNonLANConns() {
+	for _, conn := range m.host.Network().Conns() {
+		if m.gater.outsideLAN(conn.RemoteMultiaddr()) {
+			log.Printf("🌐 Closing connection to %s outside the local network", conn.RemotePeer())
+			conn.Close()
+		}
+	}
+}
+
+// startDiscovery starts the discovery backends of the current network mode.
+// The caller must hold modeMutex.
+func (m *Manager) startDiscovery() {
+	m.discoveryCtx, m.discoveryCancel = context.WithCancel(m.ctx)
+	log.Printf("🌐 Network mode: %s", m.mode)
+
+	if m.mode == ModeManual {
+		log.Printf("Discovery disabled, connect to peers manually")
+		return
+	}
+
+	go m.reconnectLoop(m.discoveryCtx, m.mode)
+
+	for _, d := range m.discoverersFor(m.mode) {
+		m.startDiscoverer(d)
+	}
+}
+
+// stopDiscovery stops all discovery backends.
+// The caller must hold modeMutex.
+func (m *Manager) stopDiscovery() {
+	if m.discoveryCancel != nil {
+		m.discoveryCancel()
+		m.discoveryCancel = nil
+	}
+
+	for _, d := range m.discoverers {
+		if err := d.Close(); err != nil {
+			log.Printf("Failed to stop %s discovery: %v", d.Name(), err)
+		}
+	}
+	m.discoverers = nil
+}
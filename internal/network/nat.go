@@ -0,0 +1,110 @@
+package network
+
+import (
+	"log"
+	"shario/internal/config"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Reachability states reported by Manager.Reachability
+const (
+	ReachabilityUnknown = "unknown"
+	ReachabilityPublic  = "public"
+	ReachabilityPrivate = "private"
+	ReachabilityRelayed = "relayed" // private, but reachable through a circuit relay
+	ReachabilityForced  = "forced public (relay service)"
+)
+
+// natOptions returns the libp2p options for NAT traversal and the resolved static relays
+func natOptions(cfg config.RelayConfig) ([]libp2p.Option, []peer.AddrInfo, error) {
+	relays, err := parsePeerAddrs("relay", cfg.StaticRelays)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	opts := []libp2p.Option{
+		libp2p.NATPortMap(),
+		// Answer AutoNAT dial-back requests so peers can learn their reachability from us
+		libp2p.EnableNATService(),
+		// Upgrade relayed connections to direct ones with DCUtR
+		libp2p.EnableHolePunching(),
+	}
+
+	if len(relays) > 0 {
+		opts = append(opts, libp2p.EnableAutoRelayWithStaticRelays(relays))
+	}
+
+	if cfg.Service {
+		// The relay service only starts on publicly reachable nodes, and a
+		// small team may not have enough peers for AutoNAT to confirm it
+		opts = append(opts, libp2p.EnableRelayService(), libp2p.ForceReachabilityPublic())
+	}
+
+	return opts, relays, nil
+}
+
+// watchReachability tracks the reachability reported by AutoNAT. Address
+// updates are watched too, since relay addresses appear after a reservation.
+func (m *Manager) watchReachability() {
+	sub, err := m.host.EventBus().Subscribe([]interface{}{
+		new(event.EvtLocalReachabilityChanged),
+		new(event.EvtLocalAddressesUpdated),
+	})
+	if err != nil {
+		log.Printf("Failed to subscribe to reachability events: %v", err)
+		return
+	}
+	defer sub.Close()
+
+	last := ReachabilityUnknown
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case e, ok := <-sub.Out():
+			if !ok {
+				return
+			}
+			if changed, isReachability := e.(event.EvtLocalReachabilityChanged); isReachability {
+				m.reachabilityMutex.Lock()
+				m.reachability = changed.Reachability
+				m.reachabilityMutex.Unlock()
+			}
+
+			if current := m.Reachability(); current != last {
+				log.Printf("🌐 Reachability changed: %s", current)
+				last = current
+			}
+		}
+	}
+}
+
+// Reachability returns whether we are publicly reachable, behind NAT, or reachable through a relay.
+// The relay service forces public reachability, so AutoNAT has nothing to tell us then.
+func (m *Manager) Reachability() string {
+	if m.forcedPublic {
+		return ReachabilityForced
+	}
+
+	m.reachabilityMutex.RLock()
+	reachability := m.reachability
+	m.reachabilityMutex.RUnlock()
+
+	switch reachability {
+	case network.ReachabilityPublic:
+		return ReachabilityPublic
+	case network.ReachabilityPrivate:
+		for _, addr := range m.host.Addrs() {
+			if isRelayedAddr(addr) {
+				return ReachabilityRelayed
+			}
+		}
+		return ReachabilityPrivate
+	default:
+		return ReachabilityUnknown
+	}
+}
@@ -0,0 +1,139 @@
+package nettest
+
+import (
+	"context"
+	"shario/internal/network"
+	"sync"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Discovery is an in-memory stand-in for mDNS. Nodes running one of its discoverers find
+// each other when they share a namespace, and tests can report peers to a node directly.
+type Discovery struct {
+	mutex       sync.Mutex
+	discoverers []*Discoverer
+}
+
+// NewDiscovery creates an empty discovery service
+func NewDiscovery() *Discovery {
+	return &Discovery{}
+}
+
+// Join adds a discoverer for the node and switches the node to LAN mode, where the
+// discoverer runs in place of mDNS
+func (d *Discovery) Join(t testing.TB, node *Node) *Discoverer {
+	t.Helper()
+
+	discoverer := &Discoverer{service: d, host: node.Host}
+	d.mutex.Lock()
+	d.discoverers = append(d.discoverers, discoverer)
+	d.mutex.Unlock()
+
+	node.Discoverer = discoverer
+	node.Network.AddDiscoverer(discoverer)
+	if err := node.Network.SetNetworkMode(network.ModeLAN); err != nil {
+		t.Fatalf("failed to switch node %s to LAN mode: %v", node.ID(), err)
+	}
+	return discoverer
+}
+
+// running returns the started discoverers other than the given one
+func (d *Discovery) running(except *Discoverer) []*Discoverer {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	var running []*Discoverer
+	for _, discoverer := range d.discoverers {
+		if discoverer != except && discoverer.started() {
+			running = append(running, discoverer)
+		}
+	}
+	return running
+}
+
+// Discoverer is the network.Discoverer of a single node on a Discovery service
+type Discoverer struct {
+	service *Discovery
+	host    host.Host
+
+	mutex      sync.Mutex
+	namespaces []string
+	found      func(peer.AddrInfo) // nil while stopped
+}
+
+// Name identifies the backend in logs
+func (d *Discoverer) Name() string {
+	return "test"
+}
+
+// Start announces the node, so it and the running nodes sharing a namespace find each other
+func (d *Discoverer) Start(ctx context.Context, namespaces []string, found func(peer.AddrInfo)) error {
+	d.mutex.Lock()
+	d.namespaces = namespaces
+	d.found = found
+	d.mutex.Unlock()
+
+	for _, other := range d.service.running(d) {
+		if !d.sharesNamespace(other) {
+			continue
+		}
+		d.Find(other.addrInfo())
+		other.Find(d.addrInfo())
+	}
+	return nil
+}
+
+// Close stops reporting peers
+func (d *Discoverer) Close() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.found = nil
+	return nil
+}
+
+// Find reports a peer to the node as if it had been discovered, which makes the node dial it.
+// It returns false when the discoverer is stopped and nothing was reported.
+func (d *Discoverer) Find(info peer.AddrInfo) bool {
+	d.mutex.Lock()
+	found := d.found
+	d.mutex.Unlock()
+
+	if found == nil {
+		return false
+	}
+	go found(info)
+	return true
+}
+
+// started reports whether the discoverer is running
+func (d *Discoverer) started() bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.found != nil
+}
+
+// sharesNamespace reports whether two discoverers announce a common namespace
+func (d *Discoverer) sharesNamespace(other *Discoverer) bool {
+	d.mutex.Lock()
+	namespaces := d.namespaces
+	d.mutex.Unlock()
+	other.mutex.Lock()
+	defer other.mutex.Unlock()
+
+	for _, a := range namespaces {
+		for _, b := range other.namespaces {
+			if a == b {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// addrInfo returns the node's ID and listen addresses as discovery would report them
+func (d *Discoverer) addrInfo() peer.AddrInfo {
+	return peer.AddrInfo{ID: d.host.ID(), Addrs: d.host.Addrs()}
+}
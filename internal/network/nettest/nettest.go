@@ -0,0 +1,156 @@
+// Package nettest builds in-memory Shario networks for integration tests
+package nettest
+
+import (
+	"context"
+	"fmt"
+	"shario/internal/identity"
+	"shario/internal/network"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// Node is a single peer in an in-memory network
+type Node struct {
+	Identity   *identity.Manager
+	Network    *network.Manager
+	Host       host.Host
+	Discoverer *Discoverer // set once the node joins a Discovery
+}
+
+// ID returns the peer ID of the node
+func (n *Node) ID() peer.ID {
+	return n.Host.ID()
+}
+
+// Mesh is a set of nodes linked through a mock network without mDNS or DHT
+type Mesh struct {
+	Mocknet   mocknet.Mocknet
+	Nodes     []*Node
+	Discovery *Discovery // stands in for mDNS on the nodes started with Discover
+}
+
+// New creates a mesh of n started nodes that are linked but not yet connected.
+// Everything is torn down when the test finishes.
+func New(t testing.TB, n int) *Mesh {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	mesh := &Mesh{Mocknet: mocknet.New(), Discovery: NewDiscovery()}
+	t.Cleanup(func() {
+		for _, node := range mesh.Nodes {
+			node.Network.Close()
+		}
+		mesh.Mocknet.Close()
+		cancel()
+	})
+
+	for i := 0; i < n; i++ {
+		identityMgr, err := identity.NewEphemeral(fmt.Sprintf("node%d", i))
+		if err != nil {
+			t.Fatalf("failed to create identity: %v", err)
+		}
+
+		addr := multiaddr.StringCast(fmt.Sprintf("/ip4/10.0.0.%d/tcp/4001", i+1))
+		h, err := mesh.Mocknet.AddPeer(identityMgr.GetPrivateKey(), addr)
+		if err != nil {
+			t.Fatalf("failed to add mock peer: %v", err)
+		}
+
+		networkMgr, err := network.NewWithHost(ctx, identityMgr, h)
+		if err != nil {
+			t.Fatalf("failed to create network manager: %v", err)
+		}
+		if err := networkMgr.Start(); err != nil {
+			t.Fatalf("failed to start network manager: %v", err)
+		}
+
+		mesh.Nodes = append(mesh.Nodes, &Node{
+			Identity: identityMgr,
+			Network:  networkMgr,
+			Host:     h,
+		})
+	}
+
+	if err := mesh.Mocknet.LinkAll(); err != nil {
+		t.Fatalf("failed to link mock peers: %v", err)
+	}
+
+	return mesh
+}
+
+// Connect dials node b from node a and waits until both sides track each other
+func (m *Mesh) Connect(t testing.TB, a, b int) {
+	t.Helper()
+
+	nodeA, nodeB := m.Nodes[a], m.Nodes[b]
+	if _, err := m.Mocknet.ConnectPeers(nodeA.ID(), nodeB.ID()); err != nil {
+		t.Fatalf("failed to connect node %d to node %d: %v", a, b, err)
+	}
+
+	WaitFor(t, 5*time.Second, func() bool {
+		return hasPeer(nodeA.Network, nodeB.ID()) && hasPeer(nodeB.Network, nodeA.ID())
+	}, "nodes %d and %d did not register each other", a, b)
+}
+
+// Discover starts the mesh's in-memory discovery on the given nodes, so they find and
+// connect to each other without being connected explicitly
+func (m *Mesh) Discover(t testing.TB, nodes ...int) {
+	t.Helper()
+
+	for _, i := range nodes {
+		m.Discovery.Join(t, m.Nodes[i])
+	}
+}
+
+// Disconnect closes all connections between two nodes, leaving them able to reconnect
+func (m *Mesh) Disconnect(t testing.TB, a, b int) {
+	t.Helper()
+
+	if err := m.Mocknet.DisconnectPeers(m.Nodes[a].ID(), m.Nodes[b].ID()); err != nil {
+		t.Fatalf("failed to disconnect node %d from node %d: %v", a, b, err)
+	}
+}
+
+// Unlink drops the link between two nodes, as if the network between them failed
+func (m *Mesh) Unlink(t testing.TB, a, b int) {
+	t.Helper()
+
+	m.Disconnect(t, a, b)
+	if err := m.Mocknet.UnlinkPeers(m.Nodes[a].ID(), m.Nodes[b].ID()); err != nil {
+		t.Fatalf("failed to unlink node %d from node %d: %v", a, b, err)
+	}
+}
+
+// Link restores the link between two nodes after Unlink, without connecting them
+func (m *Mesh) Link(t testing.TB, a, b int) {
+	t.Helper()
+
+	if _, err := m.Mocknet.LinkPeers(m.Nodes[a].ID(), m.Nodes[b].ID()); err != nil {
+		t.Fatalf("failed to link node %d to node %d: %v", a, b, err)
+	}
+}
+
+// WaitFor polls cond until it holds or the timeout expires
+func WaitFor(t testing.TB, timeout time.Duration, cond func() bool, format string, args ...interface{}) {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf(format, args...)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// hasPeer reports whether a network manager tracks the given peer
+func hasPeer(networkMgr *network.Manager, peerID peer.ID) bool {
+	_, exists := networkMgr.GetPeerInfo(peerID)
+	return exists
+}
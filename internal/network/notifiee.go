@@ -2,10 +2,8 @@ package network
 
 import (
 	"log"
-	"time"
 
 	"github.com/libp2p/go-libp2p/core/network"
-	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/multiformats/go-multiaddr"
 )
 
@@ -29,40 +27,21 @@ func (nn *networkNotifiee) Connected(n network.Network, conn network.Conn) {
 	log.Printf("  Remote address: %s", conn.RemoteMultiaddr().String())
 	log.Printf("  Local address: %s", conn.LocalMultiaddr().String())
 
-	// Create peer info
-	peer := &Peer{
-		ID:          peerID.String(),
-		Nickname:    peerID.String()[:8], // Default nickname, will be updated
-		ConnectedAt: time.Now(),
-		PeerID:      peerID,
-		Addresses:   []multiaddr.Multiaddr{conn.RemoteMultiaddr()},
-	}
-
-	// Add to peers map (check for duplicates)
 	manager := (*Manager)(nn)
-	manager.peersMutex.Lock()
+	manager.resetReconnect(peerID)
 
-	// Check if peer already exists
+	// A further connection to a Shario peer only adds its address
+	manager.peersMutex.Lock()
 	if existingPeer, exists := manager.peers[peerID]; exists {
-		log.Printf("  Peer already exists, updating connection info")
-		// Update existing peer with new address
 		existingPeer.Addresses = append(existingPeer.Addresses, conn.RemoteMultiaddr())
 		manager.peersMutex.Unlock()
-		log.Printf("  Updated existing peer, no new chat notification needed")
+		log.Printf("  Peer already exists, updated connection info")
 		return
 	}
-
-	// Add new peer
-	manager.peers[peerID] = peer
-	totalPeers := len(manager.peers)
 	manager.peersMutex.Unlock()
 
-	log.Printf("  Total peers now: %d", totalPeers)
-
-	// Notify handlers (only for new peers)
-	manager.notifyPeerConnected(peer)
-
-	log.Printf("  New peer added to chat system")
+	// New peers are added once identify shows that they speak a Shario protocol
+	log.Printf("  Waiting for identify before adding peer")
 }
 
 // Disconnected is called when we disconnect from a peer
@@ -71,6 +50,8 @@ func (nn *networkNotifiee) Disconnected(n network.Network, conn network.Conn) {
 	log.Printf("🔗 PEER DISCONNECTED: %s (connection: %s)", peerID.String(), conn.RemoteMultiaddr().String())
 
 	manager := (*Manager)(nn)
+	manager.announceMutex.Lock()
+	defer manager.announceMutex.Unlock()
 
 	// Check if we still have other connections to this peer
 	if manager.host.Network().Connectedness(peerID) == network.Connected {
@@ -78,39 +59,26 @@ func (nn *networkNotifiee) Disconnected(n network.Network, conn network.Conn) {
 		return
 	}
 
+	// Update the last-seen time before the peer is removed
+	manager.rememberPeer(peerID)
+
 	// Remove from peers map only if completely disconnected
 	manager.peersMutex.Lock()
+	p, wasPeer := manager.peers[peerID]
+	left := wasPeer && p.leaving
 	delete(manager.peers, peerID)
 	peerCount := len(manager.peers)
 	manager.peersMutex.Unlock()
 
-	log.Printf("🔗 Peer %s fully disconnected, total peers: %d", peerID.String(), peerCount)
-
-	// Notify handlers
-	manager.notifyPeerDisconnected(peerID)
-}
-
-// discoveryNotifiee implements the mdns.Notifiee interface for mDNS discovery
-type discoveryNotifiee struct {
-	manager *Manager
-}
-
-// HandlePeerFound is called when a peer is discovered via mDNS
-func (dn *discoveryNotifiee) HandlePeerFound(peerInfo peer.AddrInfo) {
-	log.Printf("🔍 mDNS Discovery: Found peer %s", peerInfo.ID.String())
-	log.Printf("  Peer addresses: %v", peerInfo.Addrs)
-
-	// Don't connect to ourselves
-	if peerInfo.ID == dn.manager.host.ID() {
-		log.Printf("  Skipping self-connection")
+	// Handlers never heard of peers that did not speak a Shario protocol or left before the hello finished
+	announced := manager.announced[peerID]
+	delete(manager.announced, peerID)
+	if !wasPeer || !announced {
 		return
 	}
 
-	// Connect to the discovered peer
-	log.Printf("  Attempting connection to peer %s...", peerInfo.ID.String())
-	if err := dn.manager.host.Connect(dn.manager.ctx, peerInfo); err != nil {
-		log.Printf("  ❌ Failed to connect to discovered peer %s: %v", peerInfo.ID, err)
-	} else {
-		log.Printf("  ✅ Successfully connected to peer %s via mDNS", peerInfo.ID.String())
-	}
+	log.Printf("🔗 Peer %s fully disconnected, total peers: %d", peerID.String(), peerCount)
+
+	// Notify handlers
+	manager.notifyPeerDisconnected(peerID, left)
 }
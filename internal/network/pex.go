@@ -0,0 +1,258 @@
+package network
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// PEXProtocol lets connected Shario peers share the other Shario peers they know
+const PEXProtocol = protocol.ID("/shario/pex/1.0.0")
+
+// Peer exchange settings
+const (
+	pexInterval = 2 * time.Minute // connected peers are asked again after this
+	pexTimeout  = 10 * time.Second
+	pexMaxDials = 4 // concurrent dials of peers learned through peer exchange
+
+	defaultPEXMaxPeers = 50
+	maxPEXPeers        = 50 // peers returned in a single answer
+	maxPEXAddrs        = 8  // addresses returned per peer
+)
+
+// pexPeer is a Shario peer shared through peer exchange
+type pexPeer struct {
+	Peer  string   `json:"peer"`
+	Addrs []string `json:"addrs"`
+}
+
+// pexResponse answers a peer exchange request. Opening the stream is the request.
+type pexResponse struct {
+	Peers []pexPeer `json:"peers"`
+}
+
+// handlePEXStream answers a peer exchange request with the peers the requester may learn about
+func (m *Manager) handlePEXStream(stream network.Stream) {
+	defer stream.Close()
+	peerID := stream.Conn().RemotePeer()
+
+	// Peers awaiting approval learn nothing about the others
+	if m.holdBack(peerID) {
+		stream.Reset()
+		return
+	}
+
+	// In allowlist mode only allowed peers learn about the others
+	ip := addrIP(stream.Conn().RemoteMultiaddr())
+	if m.gater.getMode() == AccessAllowlist && !m.gater.permits(peerID, ip) {
+		log.Printf("🚫 Refused peer exchange with %s, it is not on the allowlist", peerID)
+		stream.Reset()
+		return
+	}
+
+	stream.SetDeadline(time.Now().Add(pexTimeout))
+	data, err := json.Marshal(pexResponse{Peers: m.pexPeersFor(peerID)})
+	if err != nil {
+		log.Printf("Failed to marshal peer exchange response: %v", err)
+		return
+	}
+	if _, err := stream.Write(data); err != nil {
+		log.Printf("Failed to send peer exchange response to peer %s: %v", peerID, err)
+		stream.Reset()
+	}
+}
+
+// pexPeersFor returns the connected Shario peers shared with a requester. With workspaces
+// joined only the members of a workspace we share with the requester are included, so
+// peers never learn about the members of workspaces they did not prove membership of.
+// Peers and addresses our lists would not let us dial are left out as well.
+func (m *Manager) pexPeersFor(requester peer.ID) []pexPeer {
+	info, exists := m.GetPeerInfo(requester)
+	if !exists {
+		return nil
+	}
+
+	peers := []pexPeer{}
+	for _, p := range m.GetPeers() {
+		if p.PeerID == requester {
+			continue
+		}
+		other, exists := m.GetPeerInfo(p.PeerID)
+		if !exists || (len(m.workspaces) > 0 && !sharesWorkspace(info, other)) {
+			continue
+		}
+		if m.gater.access.IsBlocked(p.PeerID, nil) {
+			continue
+		}
+
+		var addrs []string
+		for _, addr := range m.host.Peerstore().Addrs(p.PeerID) {
+			if shareableAddr(addr) && m.gater.InterceptAddrDial(p.PeerID, addr) && len(addrs) < maxPEXAddrs {
+				addrs = append(addrs, addr.String())
+			}
+		}
+		if len(addrs) == 0 {
+			continue
+		}
+
+		peers = append(peers, pexPeer{Peer: p.PeerID.String(), Addrs: addrs})
+		if len(peers) == maxPEXPeers {
+			break
+		}
+	}
+	return peers
+}
+
+// sharesWorkspace reports whether two peers proved membership of a common workspace of ours
+func sharesWorkspace(a, b Peer) bool {
+	for _, workspace := range a.Workspaces {
+		if b.InWorkspace(workspace) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestPEX asks a connected peer for the Shario peers it knows
+func (m *Manager) requestPEX(ctx context.Context, peerID peer.ID) ([]pexPeer, error) {
+	ctx, cancel := context.WithTimeout(ctx, pexTimeout)
+	defer cancel()
+
+	stream, err := m.host.NewStream(ctx, peerID, PEXProtocol)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create peer exchange stream: %w", err)
+	}
+	defer stream.Close()
+	stream.SetDeadline(time.Now().Add(pexTimeout))
+	stream.CloseWrite()
+
+	data, err := readMessage(stream)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read peer exchange response: %w", err)
+	}
+
+	var resp pexResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal peer exchange response: %w", err)
+	}
+	return resp.Peers, nil
+}
+
+// addrInfo parses a shared peer into its ID and addresses
+func (p pexPeer) addrInfo() (peer.AddrInfo, error) {
+	peerID, err := peer.Decode(p.Peer)
+	if err != nil {
+		return peer.AddrInfo{}, fmt.Errorf("invalid peer ID: %w", err)
+	}
+
+	info := peer.AddrInfo{ID: peerID}
+	for _, addrStr := range p.Addrs {
+		if addr, err := multiaddr.NewMultiaddr(addrStr); err == nil {
+			info.Addrs = append(info.Addrs, addr)
+		}
+	}
+	return info, nil
+}
+
+// pexDiscoverer asks connected Shario peers for the Shario peers they know
+type pexDiscoverer struct {
+	manager     *Manager
+	unsubscribe func()
+}
+
+// Name identifies the backend in logs
+func (d *pexDiscoverer) Name() string {
+	return "PEX"
+}
+
+// Start asks every newly connected peer right away and all connected peers periodically.
+// Peer exchange follows our own connections, so it ignores the namespaces.
+func (d *pexDiscoverer) Start(ctx context.Context, namespaces []string, found func(peer.AddrInfo)) error {
+	m := d.manager
+	log.Printf("Starting peer exchange, dialing up to %d Shario peers", m.pexMaxPeers)
+
+	dials := make(chan struct{}, pexMaxDials)
+	d.unsubscribe = m.SubscribePeerConnected(func(event PeerConnectedEvent) {
+		go d.ask(ctx, event.Peer.PeerID, dials, found)
+	})
+
+	go func() {
+		ticker := time.NewTicker(pexInterval)
+		defer ticker.Stop()
+
+		for _, p := range m.GetPeers() {
+			go d.ask(ctx, p.PeerID, dials, found)
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				for _, p := range m.GetPeers() {
+					go d.ask(ctx, p.PeerID, dials, found)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// ask requests a peer's list and dials the new peers in it while we are below the peer limit.
+// Peers the access lists would refuse or ask about are skipped.
+func (d *pexDiscoverer) ask(ctx context.Context, peerID peer.ID, dials chan struct{}, found func(peer.AddrInfo)) {
+	m := d.manager
+	if protocols, err := m.host.Peerstore().SupportsProtocols(peerID, PEXProtocol); err != nil || len(protocols) == 0 {
+		return
+	}
+
+	peers, err := m.requestPEX(ctx, peerID)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Failed to exchange peers with %s: %v", peerID, err)
+		}
+		return
+	}
+
+	for _, shared := range peers {
+		info, err := shared.addrInfo()
+		if err != nil {
+			log.Printf("Ignoring invalid peer shared by %s: %v", peerID, err)
+			continue
+		}
+		if info.ID == m.host.ID() || len(info.Addrs) == 0 || m.host.Network().Connectedness(info.ID) == network.Connected {
+			continue
+		}
+		if !m.gater.admits(info) {
+			continue
+		}
+		if m.GetPeerCount() >= m.pexMaxPeers {
+			return
+		}
+
+		select {
+		case dials <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		go func(info peer.AddrInfo) {
+			defer func() { <-dials }()
+			found(info)
+		}(info)
+	}
+}
+
+// Close stops reacting to new connections
+func (d *pexDiscoverer) Close() error {
+	if d.unsubscribe != nil {
+		d.unsubscribe()
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package network
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/libp2p/go-libp2p/core/pnet"
+)
+
+// pskHeader is the swarm key header shared with other libp2p implementations
+const pskHeader = "/key/swarm/psk/1.0.0/\n/base16/\n"
+
+// GeneratePSK writes a new random pre-shared key file, refusing to overwrite an existing one
+func GeneratePSK(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("key file already exists: %s", path)
+	}
+
+	return writePSK(path)
+}
+
+// RotatePSK replaces the key file with a new random key, keeping the old key as <path>.prev.
+// Every peer must receive the new file before it can reconnect.
+func RotatePSK(path string) error {
+	if _, err := LoadPSK(path); err != nil {
+		return fmt.Errorf("failed to read current key: %w", err)
+	}
+
+	if err := os.Rename(path, path+".prev"); err != nil {
+		return fmt.Errorf("failed to back up current key: %w", err)
+	}
+
+	return writePSK(path)
+}
+
+// LoadPSK reads a pre-shared key file
+func LoadPSK(path string) (pnet.PSK, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	psk, err := pnet.DecodeV1PSK(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode key file %s: %w", path, err)
+	}
+
+	return psk, nil
+}
+
+// PSKFingerprint returns a short hash that identifies a key without revealing it
+func PSKFingerprint(psk pnet.PSK) string {
+	sum := sha256.Sum256(psk)
+	return hex.EncodeToString(sum[:4])
+}
+
+// writePSK generates a random 256-bit key and writes it to path
+func writePSK(path string) error {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create key directory: %w", err)
+	}
+
+	data := pskHeader + hex.EncodeToString(key) + "\n"
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		return fmt.Errorf("failed to write key file: %w", err)
+	}
+
+	return nil
+}
+
+// explainDialError adds a hint to dial errors that look like a failed private network handshake.
+// Only failures while negotiating the security protocol qualify, which is the first exchange
+// over the key-encrypted connection, so a peer with another key fails there and nowhere else.
+func (m *Manager) explainDialError(err error) error {
+	if err == nil || m.pskFingerprint == "" {
+		return err
+	}
+
+	if strings.Contains(err.Error(), "failed to negotiate security protocol") {
+		return fmt.Errorf("%w (the peer may not be using this network's pre-shared key, fingerprint %s)", err, m.pskFingerprint)
+	}
+
+	return err
+}
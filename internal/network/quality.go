@@ -0,0 +1,174 @@
+package network
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/p2p/protocol/ping"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// Connection quality monitoring
+const (
+	qualityInterval = 15 * time.Second // how often connected peers are pinged
+	pingTimeout     = 10 * time.Second
+	maxRTTSamples   = 20 // round trip times kept per peer
+)
+
+// Connection types reported on Peer.ConnType
+const (
+	ConnTypeLAN     = "lan"     // direct connection over a private network address
+	ConnTypeDirect  = "direct"  // direct connection over a public address
+	ConnTypeRelayed = "relayed" // connection through a circuit relay
+)
+
+// LatestRTT returns the most recent round trip time, or 0 if the peer was not pinged yet
+func (p *Peer) LatestRTT() time.Duration {
+	if len(p.RTTs) == 0 {
+		return 0
+	}
+	return p.RTTs[len(p.RTTs)-1]
+}
+
+// AverageRTT returns the mean of the recorded round trip times
+func (p *Peer) AverageRTT() time.Duration {
+	if len(p.RTTs) == 0 {
+		return 0
+	}
+	var total time.Duration
+	for _, rtt := range p.RTTs {
+		total += rtt
+	}
+	return total / time.Duration(len(p.RTTs))
+}
+
+// qualityLoop periodically pings connected peers and refreshes their connection details
+func (m *Manager) qualityLoop() {
+	ticker := time.NewTicker(qualityInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+			for _, p := range m.GetPeers() {
+				go m.measurePeer(p.PeerID)
+			}
+		}
+	}
+}
+
+// measurePeer pings a peer once and records the result with its connection type and byte counters
+func (m *Manager) measurePeer(peerID peer.ID) {
+	ctx, cancel := context.WithTimeout(m.ctx, pingTimeout)
+	defer cancel()
+
+	var rtt time.Duration
+	result := <-ping.Ping(ctx, m.host, peerID)
+	if result.Error != nil {
+		if m.ctx.Err() == nil {
+			log.Printf("Failed to ping peer %s: %v", peerID, result.Error)
+		}
+	} else {
+		rtt = result.RTT
+	}
+
+	connType, transport := m.connectionType(peerID)
+
+	var bytesIn, bytesOut int64
+	if m.bandwidth != nil {
+		stats := m.bandwidth.GetBandwidthForPeer(peerID)
+		bytesIn, bytesOut = stats.TotalIn, stats.TotalOut
+	}
+
+	m.peersMutex.Lock()
+	defer m.peersMutex.Unlock()
+
+	p, exists := m.peers[peerID]
+	if !exists {
+		return
+	}
+	if rtt > 0 {
+		p.RTTs = append(p.RTTs, rtt)
+		if len(p.RTTs) > maxRTTSamples {
+			p.RTTs = append([]time.Duration(nil), p.RTTs[len(p.RTTs)-maxRTTSamples:]...)
+		}
+	}
+	p.ConnType = connType
+	p.Transport = transport
+	p.BytesIn = bytesIn
+	p.BytesOut = bytesOut
+}
+
+// connectionType returns how we are connected to a peer, preferring direct connections over relayed ones
+func (m *Manager) connectionType(peerID peer.ID) (string, string) {
+	connType, transport := "", ""
+	for _, conn := range m.host.Network().ConnsToPeer(peerID) {
+		addr := conn.RemoteMultiaddr()
+		if isRelayedAddr(addr) {
+			if connType == "" {
+				connType, transport = ConnTypeRelayed, addrTransport(addr)
+			}
+			continue
+		}
+
+		connType, transport = ConnTypeDirect, addrTransport(addr)
+		if manet.IsPrivateAddr(addr) {
+			connType = ConnTypeLAN
+		}
+		break
+	}
+	return connType, transport
+}
+
+// isRelayedAddr reports whether an address goes through a circuit relay
+func isRelayedAddr(addr multiaddr.Multiaddr) bool {
+	_, err := addr.ValueForProtocol(multiaddr.P_CIRCUIT)
+	return err == nil
+}
+
+// addrTransport names the transport an address uses
+func addrTransport(addr multiaddr.Multiaddr) string {
+	for _, proto := range []struct {
+		code int
+		name string
+	}{
+		{multiaddr.P_WEBTRANSPORT, "webtransport"},
+		{multiaddr.P_QUIC_V1, "quic"},
+		{multiaddr.P_WS, "websocket"},
+		{multiaddr.P_TCP, "tcp"},
+	} {
+		if _, err := addr.ValueForProtocol(proto.code); err == nil {
+			return proto.name
+		}
+	}
+	return "unknown"
+}
+
+// GetPeerInfo returns a copy of a connected peer that is safe to read while the peer is updated
+func (m *Manager) GetPeerInfo(peerID peer.ID) (Peer, bool) {
+	m.peersMutex.RLock()
+	defer m.peersMutex.RUnlock()
+
+	p, exists := m.peers[peerID]
+	if !exists {
+		return Peer{}, false
+	}
+	return copyPeer(p), true
+}
+
+// copyPeer returns a copy of a peer sharing none of its slices, the caller holds peersMutex
+func copyPeer(p *Peer) Peer {
+	info := *p
+	info.Addresses = append([]multiaddr.Multiaddr(nil), p.Addresses...)
+	info.Protocols = append([]protocol.ID(nil), p.Protocols...)
+	info.Capabilities = append([]string(nil), p.Capabilities...)
+	info.Workspaces = append([]string(nil), p.Workspaces...)
+	info.RTTs = append([]time.Duration(nil), p.RTTs...)
+	return info
+}
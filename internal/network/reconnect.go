@@ -0,0 +1,203 @@
+package network
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Reconnect timing for known peers
+const (
+	reconnectInterval    = 5 * time.Second
+	reconnectMinBackoff  = 10 * time.Second
+	reconnectMaxBackoff  = 30 * time.Minute
+	favoriteMaxBackoff   = 2 * time.Minute
+	reconnectMaxPeerAge  = 7 * 24 * time.Hour // older peers are only redialed when they are favorites
+	reconnectMaxInFlight = 8
+)
+
+// reconnectState tracks the redial backoff of a single known peer
+type reconnectState struct {
+	backoff time.Duration
+	next    time.Time
+	dialing bool
+}
+
+// watchIdentify adds peers to the peer list and address book once identify shows that they run Shario
+func (m *Manager) watchIdentify() {
+	sub, err := m.host.EventBus().Subscribe(new(event.EvtPeerIdentificationCompleted))
+	if err != nil {
+		log.Printf("Failed to subscribe to identify events: %v", err)
+		return
+	}
+	defer sub.Close()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case e, ok := <-sub.Out():
+			if !ok {
+				return
+			}
+			peerID := e.(event.EvtPeerIdentificationCompleted).Peer
+			if m.isSharioPeer(peerID) {
+				m.admitPeer(peerID)
+				m.rememberPeer(peerID)
+			}
+		}
+	}
+}
+
+// rememberPeer records a connected Shario peer and its current addresses in the address book
+func (m *Manager) rememberPeer(peerID peer.ID) {
+	protocols, err := m.host.Peerstore().SupportsProtocols(peerID, ChatProtocol, TransferProtocol)
+	if err != nil || len(protocols) == 0 {
+		return
+	}
+
+	nickname := ""
+	m.peersMutex.RLock()
+	if p, exists := m.peers[peerID]; exists && p.Nickname != defaultNickname(peerID) {
+		nickname = p.Nickname
+	}
+	m.peersMutex.RUnlock()
+
+	if err := m.addressBook.Seen(peerID, nickname, m.host.Peerstore().Addrs(peerID)); err != nil {
+		log.Printf("Failed to save address book: %v", err)
+	}
+}
+
+// reconnectLoop periodically redials known peers that are offline. In LAN mode only their
+// addresses on the local network are dialed.
+func (m *Manager) reconnectLoop(ctx context.Context, mode string) {
+	ticker := time.NewTicker(reconnectInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.reconnectKnownPeers(mode == ModeLAN)
+		}
+	}
+}
+
+// reconnectKnownPeers starts a redial for every offline known peer whose backoff has expired
+func (m *Manager) reconnectKnownPeers(lanOnly bool) {
+	now := time.Now()
+
+	m.reconnectMutex.Lock()
+	defer m.reconnectMutex.Unlock()
+
+	inFlight := 0
+	for _, state := range m.reconnects {
+		if state.dialing {
+			inFlight++
+		}
+	}
+
+	for _, known := range m.addressBook.Peers() {
+		if inFlight >= reconnectMaxInFlight {
+			return
+		}
+		if known.ID == m.host.ID() || len(known.Addrs) == 0 {
+			continue
+		}
+		if !known.Favorite && now.Sub(known.LastSeen) > reconnectMaxPeerAge {
+			continue
+		}
+		if m.host.Network().Connectedness(known.ID) == network.Connected {
+			continue
+		}
+		info := known.AddrInfo()
+		if lanOnly {
+			info.Addrs = lanAddrs(info.Addrs)
+		}
+		if len(info.Addrs) == 0 || m.gater.refusal(info) != "" {
+			continue
+		}
+
+		state, exists := m.reconnects[known.ID]
+		if !exists {
+			state = &reconnectState{}
+			m.reconnects[known.ID] = state
+		}
+		if state.dialing || now.Before(state.next) {
+			continue
+		}
+
+		state.dialing = true
+		inFlight++
+		go m.redial(info, known.Favorite, state)
+	}
+}
+
+// redial dials a known peer once, doubling its backoff on failure
+func (m *Manager) redial(info peer.AddrInfo, favorite bool, state *reconnectState) {
+	ctx, cancel := context.WithTimeout(m.ctx, ConnectionTimeout)
+	defer cancel()
+	err := m.Connect(ctx, info)
+
+	m.reconnectMutex.Lock()
+	defer m.reconnectMutex.Unlock()
+
+	state.dialing = false
+	if err == nil {
+		log.Printf("🔗 Reconnected to known peer %s", info.ID)
+		delete(m.reconnects, info.ID)
+		return
+	}
+
+	maxBackoff := reconnectMaxBackoff
+	if favorite {
+		maxBackoff = favoriteMaxBackoff
+	}
+	state.backoff *= 2
+	if state.backoff < reconnectMinBackoff {
+		state.backoff = reconnectMinBackoff
+	}
+	if state.backoff > maxBackoff {
+		state.backoff = maxBackoff
+	}
+	state.next = time.Now().Add(state.backoff)
+	log.Printf("Failed to reconnect to known peer %s, retrying in %s: %v", info.ID, state.backoff, err)
+}
+
+// resetReconnect clears the backoff of a peer after it connected
+func (m *Manager) resetReconnect(peerID peer.ID) {
+	m.reconnectMutex.Lock()
+	defer m.reconnectMutex.Unlock()
+
+	if state, exists := m.reconnects[peerID]; exists && !state.dialing {
+		delete(m.reconnects, peerID)
+	}
+}
+
+// GetKnownPeers returns the peers in the address book, favorites first
+func (m *Manager) GetKnownPeers() []KnownPeer {
+	return m.addressBook.Peers()
+}
+
+// SetFavorite marks a known peer as favorite, favorites are redialed more eagerly and never forgotten
+func (m *Manager) SetFavorite(peerID peer.ID, favorite bool) error {
+	// A connected peer may not have been recorded yet
+	if m.host.Network().Connectedness(peerID) == network.Connected {
+		m.rememberPeer(peerID)
+	}
+	return m.addressBook.SetFavorite(peerID, favorite)
+}
+
+// ForgetPeer removes a peer from the address book so it is no longer redialed
+func (m *Manager) ForgetPeer(peerID peer.ID) error {
+	m.reconnectMutex.Lock()
+	delete(m.reconnects, peerID)
+	m.reconnectMutex.Unlock()
+
+	return m.addressBook.Forget(peerID)
+}
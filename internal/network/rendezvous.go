@@ -0,0 +1,395 @@
+package network
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// RendezvousProtocol registers peers under namespaces with a rendezvous point and looks them up.
+// It follows the model of the libp2p rendezvous spec (register, unregister and discover with a
+// TTL, registrations bound to the authenticated peer ID) but is not wire compatible with it.
+// go-libp2p-rendezvous keeps its registrations in SQLite through cgo, which our CGO_ENABLED=0
+// and cross-compiled builds cannot link, and we want any Shario node to be able to act as a point.
+// Requests are JSON, one per stream, like our other protocols.
+const RendezvousProtocol = protocol.ID("/shario/rendezvous/1.0.0")
+
+// Rendezvous settings
+const (
+	rendezvousTTL          = 15 * time.Minute // registrations are renewed after half of it
+	maxRendezvousTTL       = 2 * time.Hour
+	rendezvousPollInterval = 30 * time.Second
+	rendezvousTimeout      = 10 * time.Second
+
+	maxRendezvousNamespaceLen = 255
+	maxRendezvousNamespaces   = 32    // namespaces a single peer may register under
+	maxRendezvousRegistration = 1000  // peers registered under a single namespace
+	maxRendezvousTotalSpaces  = 1000  // namespaces a point keeps
+	maxRendezvousTotal        = 10000 // registrations a point keeps across all namespaces
+	maxRendezvousAddrs        = 8     // addresses kept per registration
+	maxRendezvousResults      = 100   // registrations returned by a lookup
+)
+
+// Rendezvous request types
+const (
+	RendezvousRegister   = "register"
+	RendezvousUnregister = "unregister"
+	RendezvousDiscover   = "discover"
+)
+
+// Rendezvous response statuses
+const (
+	RendezvousOK      = "ok"
+	RendezvousInvalid = "invalid" // malformed request or namespace
+	RendezvousLimit   = "limit"   // too many registrations
+)
+
+// rendezvousRequest is sent by a client, one request per stream
+type rendezvousRequest struct {
+	Type      string   `json:"type"`
+	Namespace string   `json:"namespace"`
+	Addrs     []string `json:"addrs,omitempty"`
+	TTL       int      `json:"ttl,omitempty"` // seconds
+}
+
+// rendezvousResponse answers a rendezvous request
+type rendezvousResponse struct {
+	Status        string                   `json:"status"`
+	Error         string                   `json:"error,omitempty"`
+	Registrations []rendezvousRegistration `json:"registrations,omitempty"`
+}
+
+// rendezvousRegistration is a peer registered under a namespace
+type rendezvousRegistration struct {
+	Peer  string   `json:"peer"`
+	Addrs []string `json:"addrs"`
+}
+
+// rendezvousRecord is a registration kept by the rendezvous point
+type rendezvousRecord struct {
+	addrs   []string
+	expires time.Time
+}
+
+// rendezvousServer keeps the registrations of a rendezvous point in memory
+type rendezvousServer struct {
+	registrations map[string]map[peer.ID]rendezvousRecord // by namespace
+	mutex         sync.Mutex
+}
+
+// newRendezvousServer creates an empty rendezvous point
+func newRendezvousServer() *rendezvousServer {
+	return &rendezvousServer{registrations: make(map[string]map[peer.ID]rendezvousRecord)}
+}
+
+// handleRendezvousStream answers a request sent to our rendezvous point
+func (m *Manager) handleRendezvousStream(stream network.Stream) {
+	defer stream.Close()
+	peerID := stream.Conn().RemotePeer()
+
+	stream.SetDeadline(time.Now().Add(rendezvousTimeout))
+	data, err := readMessage(stream)
+	if err != nil {
+		log.Printf("Failed to read rendezvous request from peer %s: %v", peerID, err)
+		return
+	}
+
+	var req rendezvousRequest
+	resp := rendezvousResponse{Status: RendezvousInvalid, Error: "malformed request"}
+	if err := json.Unmarshal(data, &req); err == nil {
+		resp = m.rendezvous.handle(peerID, stream.Conn().RemoteMultiaddr(), req)
+	}
+
+	data, err = json.Marshal(resp)
+	if err != nil {
+		log.Printf("Failed to marshal rendezvous response: %v", err)
+		return
+	}
+	if _, err := stream.Write(data); err != nil {
+		log.Printf("Failed to send rendezvous response to peer %s: %v", peerID, err)
+		stream.Reset()
+	}
+}
+
+// handle applies a request from a peer. Peers can only register themselves, since
+// the registration is stored under the authenticated peer ID of the stream.
+func (s *rendezvousServer) handle(peerID peer.ID, observed multiaddr.Multiaddr, req rendezvousRequest) rendezvousResponse {
+	if req.Namespace == "" || len(req.Namespace) > maxRendezvousNamespaceLen {
+		return rendezvousResponse{Status: RendezvousInvalid, Error: "invalid namespace"}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.prune(time.Now())
+
+	switch req.Type {
+	case RendezvousRegister:
+		return s.register(peerID, observed, req)
+	case RendezvousUnregister:
+		delete(s.registrations[req.Namespace], peerID)
+		return rendezvousResponse{Status: RendezvousOK}
+	case RendezvousDiscover:
+		return s.discover(peerID, req.Namespace)
+	default:
+		return rendezvousResponse{Status: RendezvousInvalid, Error: fmt.Sprintf("unknown request type: %s", req.Type)}
+	}
+}
+
+// register stores a registration, adding the address the peer connected from.
+// The caller must hold the mutex.
+func (s *rendezvousServer) register(peerID peer.ID, observed multiaddr.Multiaddr, req rendezvousRequest) rendezvousResponse {
+	registered := s.registrations[req.Namespace]
+	if _, exists := registered[peerID]; !exists {
+		if len(registered) >= maxRendezvousRegistration {
+			return rendezvousResponse{Status: RendezvousLimit, Error: "namespace is full"}
+		}
+		if registered == nil && len(s.registrations) >= maxRendezvousTotalSpaces {
+			return rendezvousResponse{Status: RendezvousLimit, Error: "rendezvous point is full"}
+		}
+		namespaces, total := 0, 0
+		for _, peers := range s.registrations {
+			if _, exists := peers[peerID]; exists {
+				namespaces++
+			}
+			total += len(peers)
+		}
+		if namespaces >= maxRendezvousNamespaces {
+			return rendezvousResponse{Status: RendezvousLimit, Error: "too many namespaces"}
+		}
+		if total >= maxRendezvousTotal {
+			return rendezvousResponse{Status: RendezvousLimit, Error: "rendezvous point is full"}
+		}
+	}
+
+	var addrs []string
+	for _, addr := range req.Addrs {
+		if _, err := multiaddr.NewMultiaddr(addr); err == nil && len(addrs) < maxRendezvousAddrs {
+			addrs = appendUnique(addrs, addr)
+		}
+	}
+	// The address the peer connected from helps when it does not know its public address
+	if observed != nil && len(addrs) < maxRendezvousAddrs {
+		addrs = appendUnique(addrs, observed.String())
+	}
+
+	ttl := rendezvousTTL
+	if req.TTL > 0 {
+		ttl = time.Duration(req.TTL) * time.Second
+	}
+	if ttl > maxRendezvousTTL {
+		ttl = maxRendezvousTTL
+	}
+
+	if registered == nil {
+		registered = make(map[peer.ID]rendezvousRecord)
+		s.registrations[req.Namespace] = registered
+	}
+	registered[peerID] = rendezvousRecord{addrs: addrs, expires: time.Now().Add(ttl)}
+	return rendezvousResponse{Status: RendezvousOK}
+}
+
+// discover returns the peers registered under a namespace, except the one asking.
+// The caller must hold the mutex.
+func (s *rendezvousServer) discover(peerID peer.ID, namespace string) rendezvousResponse {
+	resp := rendezvousResponse{Status: RendezvousOK}
+	for registeredID, record := range s.registrations[namespace] {
+		if registeredID == peerID {
+			continue
+		}
+		if len(resp.Registrations) >= maxRendezvousResults {
+			break
+		}
+		resp.Registrations = append(resp.Registrations, rendezvousRegistration{
+			Peer:  registeredID.String(),
+			Addrs: record.addrs,
+		})
+	}
+	return resp
+}
+
+// prune drops expired registrations. The caller must hold the mutex.
+func (s *rendezvousServer) prune(now time.Time) {
+	for namespace, peers := range s.registrations {
+		for peerID, record := range peers {
+			if now.After(record.expires) {
+				delete(peers, peerID)
+			}
+		}
+		if len(peers) == 0 {
+			delete(s.registrations, namespace)
+		}
+	}
+}
+
+// rendezvousRequest sends a request to a rendezvous point. Our own point is asked directly.
+func (m *Manager) rendezvousRequest(ctx context.Context, point peer.AddrInfo, req rendezvousRequest) (rendezvousResponse, error) {
+	if point.ID == m.host.ID() {
+		if m.rendezvous == nil {
+			return rendezvousResponse{}, fmt.Errorf("not running a rendezvous point")
+		}
+		return m.rendezvous.handle(point.ID, nil, req), nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, rendezvousTimeout)
+	defer cancel()
+
+	if err := m.Connect(ctx, point); err != nil {
+		return rendezvousResponse{}, err
+	}
+
+	stream, err := m.host.NewStream(ctx, point.ID, RendezvousProtocol)
+	if err != nil {
+		return rendezvousResponse{}, fmt.Errorf("failed to create rendezvous stream: %w", err)
+	}
+	defer stream.Close()
+	stream.SetDeadline(time.Now().Add(rendezvousTimeout))
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return rendezvousResponse{}, fmt.Errorf("failed to marshal rendezvous request: %w", err)
+	}
+	if _, err := stream.Write(data); err != nil {
+		stream.Reset()
+		return rendezvousResponse{}, fmt.Errorf("failed to send rendezvous request: %w", err)
+	}
+	stream.CloseWrite()
+
+	data, err = readMessage(stream)
+	if err != nil {
+		return rendezvousResponse{}, fmt.Errorf("failed to read rendezvous response: %w", err)
+	}
+
+	var resp rendezvousResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return rendezvousResponse{}, fmt.Errorf("failed to unmarshal rendezvous response: %w", err)
+	}
+	if resp.Status != RendezvousOK {
+		return resp, fmt.Errorf("rendezvous point refused %s: %s (%s)", req.Type, resp.Error, resp.Status)
+	}
+	return resp, nil
+}
+
+// rendezvousDiscoverer registers us with rendezvous points and searches them for peers
+type rendezvousDiscoverer struct {
+	manager    *Manager
+	points     []peer.AddrInfo
+	namespaces []string
+}
+
+// Name identifies the backend in logs
+func (d *rendezvousDiscoverer) Name() string {
+	return "rendezvous"
+}
+
+// Start registers under the namespaces and keeps the registrations and peer lookups fresh
+func (d *rendezvousDiscoverer) Start(ctx context.Context, namespaces []string, found func(peer.AddrInfo)) error {
+	d.namespaces = namespaces
+	log.Printf("Starting rendezvous discovery with %d rendezvous points", len(d.points))
+
+	go func() {
+		refresh := time.NewTicker(rendezvousTTL / 2)
+		defer refresh.Stop()
+		poll := time.NewTicker(rendezvousPollInterval)
+		defer poll.Stop()
+
+		d.register(ctx)
+		d.discover(ctx, found)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-refresh.C:
+				d.register(ctx)
+			case <-poll.C:
+				d.discover(ctx, found)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// register registers us under every namespace with every rendezvous point
+func (d *rendezvousDiscoverer) register(ctx context.Context) {
+	var addrs []string
+	for _, addr := range d.manager.host.Addrs() {
+		addrs = append(addrs, addr.String())
+	}
+
+	for _, point := range d.points {
+		for _, namespace := range d.namespaces {
+			req := rendezvousRequest{Type: RendezvousRegister, Namespace: namespace, Addrs: addrs, TTL: int(rendezvousTTL / time.Second)}
+			if _, err := d.manager.rendezvousRequest(ctx, point, req); err != nil {
+				if ctx.Err() == nil {
+					log.Printf("⚠️ Failed to register with rendezvous point %s: %v", point.ID, err)
+				}
+				break
+			}
+		}
+	}
+}
+
+// discover asks every rendezvous point for the peers registered under our namespaces
+func (d *rendezvousDiscoverer) discover(ctx context.Context, found func(peer.AddrInfo)) {
+	for _, point := range d.points {
+		for _, namespace := range d.namespaces {
+			resp, err := d.manager.rendezvousRequest(ctx, point, rendezvousRequest{Type: RendezvousDiscover, Namespace: namespace})
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Failed to search rendezvous point %s: %v", point.ID, err)
+				}
+				break
+			}
+
+			for _, registration := range resp.Registrations {
+				info, err := registration.addrInfo()
+				if err != nil {
+					log.Printf("Ignoring invalid registration from rendezvous point %s: %v", point.ID, err)
+					continue
+				}
+				found(info)
+			}
+		}
+	}
+}
+
+// Close unregisters us from the rendezvous points in the background, registrations expire anyway
+func (d *rendezvousDiscoverer) Close() error {
+	go func() {
+		ctx, cancel := context.WithTimeout(d.manager.ctx, rendezvousTimeout)
+		defer cancel()
+
+		for _, point := range d.points {
+			for _, namespace := range d.namespaces {
+				if _, err := d.manager.rendezvousRequest(ctx, point, rendezvousRequest{Type: RendezvousUnregister, Namespace: namespace}); err != nil {
+					break
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// addrInfo parses a registration into the peer's ID and addresses
+func (r rendezvousRegistration) addrInfo() (peer.AddrInfo, error) {
+	peerID, err := peer.Decode(r.Peer)
+	if err != nil {
+		return peer.AddrInfo{}, fmt.Errorf("invalid peer ID: %w", err)
+	}
+
+	info := peer.AddrInfo{ID: peerID}
+	for _, addrStr := range r.Addrs {
+		if addr, err := multiaddr.NewMultiaddr(addrStr); err == nil {
+			info.Addrs = append(info.Addrs, addr)
+		}
+	}
+	return info, nil
+}
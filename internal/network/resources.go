@@ -0,0 +1,76 @@
+package network
+
+import (
+	"fmt"
+	"shario/internal/config"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/metrics"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
+)
+
+// NetworkStats summarizes the traffic and resources used by the host
+type NetworkStats struct {
+	TotalIn     int64
+	TotalOut    int64
+	RateIn      float64 // bytes per second
+	RateOut     float64 // bytes per second
+	Protocols   map[protocol.ID]metrics.Stats
+	Connections int
+	Streams     int
+	Memory      int64 // bytes reserved through the resource manager
+}
+
+// resourceManager creates a resource manager that applies the configured limits on top of the scaled defaults
+func resourceManager(cfg config.LimitsConfig) (network.ResourceManager, error) {
+	scaling := rcmgr.DefaultLimits
+	libp2p.SetDefaultServiceLimits(&scaling)
+
+	var limits rcmgr.PartialLimitConfig
+	if cfg.MaxConnections > 0 {
+		limits.System.Conns = rcmgr.LimitVal(cfg.MaxConnections)
+	}
+	if cfg.MaxStreamsPerPeer > 0 {
+		limits.PeerDefault.Streams = rcmgr.LimitVal(cfg.MaxStreamsPerPeer)
+		limits.PeerDefault.StreamsInbound = rcmgr.LimitVal(cfg.MaxStreamsPerPeer)
+		limits.PeerDefault.StreamsOutbound = rcmgr.LimitVal(cfg.MaxStreamsPerPeer)
+	}
+	if cfg.MaxMemoryMB > 0 {
+		limits.System.Memory = rcmgr.LimitVal64(cfg.MaxMemoryMB) << 20
+	}
+
+	rm, err := rcmgr.NewResourceManager(rcmgr.NewFixedLimiter(limits.Build(scaling.AutoScale())))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create resource manager: %w", err)
+	}
+	return rm, nil
+}
+
+// Stats returns the traffic totals, per-protocol rates and resource usage of the host
+func (m *Manager) Stats() NetworkStats {
+	stats := NetworkStats{Protocols: make(map[protocol.ID]metrics.Stats)}
+
+	if m.bandwidth != nil {
+		totals := m.bandwidth.GetBandwidthTotals()
+		stats.TotalIn, stats.TotalOut = totals.TotalIn, totals.TotalOut
+		stats.RateIn, stats.RateOut = totals.RateIn, totals.RateOut
+		for proto, protoStats := range m.bandwidth.GetBandwidthByProtocol() {
+			stats.Protocols[proto] = protoStats
+		}
+	}
+
+	conns := m.host.Network().Conns()
+	stats.Connections = len(conns)
+	for _, conn := range conns {
+		stats.Streams += len(conn.GetStreams())
+	}
+
+	m.host.Network().ResourceManager().ViewSystem(func(scope network.ResourceScope) error {
+		stats.Memory = scope.Stat().Memory
+		return nil
+	})
+
+	return stats
+}
@@ -0,0 +1,77 @@
+package network
+
+import (
+	"log"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// Newer versions of the message protocols. Peers speaking 1.1.0 answer message types they
+// do not know with an unsupported reply, 1.0.0 peers log and drop them.
+const (
+	ChatProtocolV11     = protocol.ID("/shario/chat/1.1.0")
+	TransferProtocolV11 = protocol.ID("/shario/transfer/1.1.0")
+)
+
+// protocolVersions lists the versions we speak of each message protocol, newest first.
+// A stream is opened with the newest version both sides support, and messages are
+// published under the protocol's 1.0.0 ID whatever version they arrived on.
+var protocolVersions = map[protocol.ID][]protocol.ID{
+	ChatProtocol:     {ChatProtocolV11, ChatProtocol},
+	TransferProtocol: {TransferProtocolV11, TransferProtocol},
+}
+
+// ProtocolVersions returns the versions we speak of a message protocol, newest first
+func ProtocolVersions(proto protocol.ID) []protocol.ID {
+	if versions, ok := protocolVersions[proto]; ok {
+		return append([]protocol.ID(nil), versions...)
+	}
+	return []protocol.ID{proto}
+}
+
+// SupportsReplies reports whether a message arrived on a protocol version that accepts
+// unsupported replies, so a receiver knows whether answering an unknown type is safe
+func SupportsReplies(event MessageEvent) bool {
+	return event.Version != "" && event.Version != event.Protocol
+}
+
+// setMessageHandlers registers a stream handler for every version of the message protocols
+func (m *Manager) setMessageHandlers() {
+	for proto, versions := range protocolVersions {
+		for _, version := range versions {
+			m.host.SetStreamHandler(version, m.messageStreamHandler(proto, version))
+		}
+	}
+}
+
+// messageStreamHandler returns the handler reading messages sent with one protocol version
+func (m *Manager) messageStreamHandler(proto, version protocol.ID) network.StreamHandler {
+	return func(stream network.Stream) {
+		defer stream.Close()
+
+		if m.holdBack(stream.Conn().RemotePeer()) {
+			stream.Reset()
+			return
+		}
+
+		data, err := readMessage(stream)
+		if err != nil {
+			log.Printf("Failed to read %s message: %v", version, err)
+			return
+		}
+
+		m.notifyMessage(stream.Conn().RemotePeer(), proto, version, data)
+	}
+}
+
+// localProtocols returns the protocols we announce in our hello profile
+func localProtocols() []string {
+	protocols := []string{string(HelloProtocol)}
+	for _, proto := range []protocol.ID{ChatProtocol, TransferProtocol} {
+		for _, version := range protocolVersions[proto] {
+			protocols = append(protocols, string(version))
+		}
+	}
+	return protocols
+}
@@ -0,0 +1,135 @@
+package network
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"regexp"
+	"shario/internal/config"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// workspaceNamePattern keeps workspace names usable inside mDNS service tags
+var workspaceNamePattern = regexp.MustCompile(`^[A-Za-z0-9-]{1,40}$`)
+
+// Workspace is a named discovery namespace. Members find each other through
+// its own mDNS service tag and DHT rendezvous key.
+type Workspace struct {
+	Name string
+	key  []byte // proves membership in the hello exchange, nil for open workspaces
+}
+
+// WorkspaceClaim announces membership of a workspace in the hello exchange
+type WorkspaceClaim struct {
+	Namespace string `json:"namespace"`
+	Proof     string `json:"proof,omitempty"` // HMAC over both peer IDs, keyed workspaces only
+}
+
+// workspacesFromConfig validates the configured workspaces and loads their keys
+func workspacesFromConfig(cfgs []config.WorkspaceConfig) ([]Workspace, error) {
+	workspaces := make([]Workspace, 0, len(cfgs))
+	names := make(map[string]bool)
+	for _, cfg := range cfgs {
+		if !workspaceNamePattern.MatchString(cfg.Name) {
+			return nil, fmt.Errorf("invalid workspace name %q: use up to 40 letters, digits and dashes", cfg.Name)
+		}
+		if names[cfg.Name] {
+			return nil, fmt.Errorf("workspace %s is configured twice", cfg.Name)
+		}
+		names[cfg.Name] = true
+
+		workspace := Workspace{Name: cfg.Name}
+		if cfg.PSKFile != "" {
+			psk, err := LoadPSK(cfg.PSKFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load key of workspace %s: %w", cfg.Name, err)
+			}
+			workspace.key = psk
+		}
+		workspaces = append(workspaces, workspace)
+	}
+	return workspaces, nil
+}
+
+// Namespace returns the mDNS service tag and DHT rendezvous key of the workspace.
+// Keyed workspaces derive it from the key, so their name is never broadcast.
+func (w Workspace) Namespace() string {
+	if w.key == nil {
+		return ServiceTag + "-" + w.Name
+	}
+	sum := sha256.Sum256(append([]byte("shario-workspace:"), w.key...))
+	return ServiceTag + "-" + hex.EncodeToString(sum[:8])
+}
+
+// proof returns the membership proof the sender presents to the receiver
+func (w Workspace) proof(sender, receiver peer.ID) string {
+	mac := hmac.New(sha256.New, w.key)
+	mac.Write([]byte(sender + "/" + receiver))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Workspaces returns the names of the workspaces this node joined
+func (m *Manager) Workspaces() []string {
+	names := make([]string, 0, len(m.workspaces))
+	for _, workspace := range m.workspaces {
+		names = append(names, workspace.Name)
+	}
+	return names
+}
+
+// namespaces returns the discovery namespaces to search, the global one when no workspace is joined
+func (m *Manager) namespaces() []string {
+	if len(m.workspaces) == 0 {
+		return []string{ServiceTag}
+	}
+	namespaces := make([]string, 0, len(m.workspaces))
+	for _, workspace := range m.workspaces {
+		namespaces = append(namespaces, workspace.Namespace())
+	}
+	return namespaces
+}
+
+// workspaceClaims returns our memberships as presented to a peer
+func (m *Manager) workspaceClaims(remote peer.ID) []WorkspaceClaim {
+	claims := make([]WorkspaceClaim, 0, len(m.workspaces))
+	for _, workspace := range m.workspaces {
+		claim := WorkspaceClaim{Namespace: workspace.Namespace()}
+		if workspace.key != nil {
+			claim.Proof = workspace.proof(m.host.ID(), remote)
+		}
+		claims = append(claims, claim)
+	}
+	return claims
+}
+
+// sharedWorkspaces returns the names of our workspaces a peer proved membership of
+func (m *Manager) sharedWorkspaces(remote peer.ID, claims []WorkspaceClaim) []string {
+	var shared []string
+	for _, workspace := range m.workspaces {
+		for _, claim := range claims {
+			if claim.Namespace != workspace.Namespace() {
+				continue
+			}
+			if workspace.key != nil && !hmac.Equal([]byte(claim.Proof), []byte(workspace.proof(remote, m.host.ID()))) {
+				log.Printf("🚫 Peer %s failed to prove membership of workspace %s", remote, workspace.Name)
+				break
+			}
+			shared = append(shared, workspace.Name)
+			break
+		}
+	}
+	return shared
+}
+
+// InWorkspace reports whether the peer proved membership of one of our workspaces
+func (p *Peer) InWorkspace(name string) bool {
+	for _, workspace := range p.Workspaces {
+		if workspace == name {
+			return true
+		}
+	}
+	return false
+}
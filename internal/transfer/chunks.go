@@ -0,0 +1,33 @@
+package transfer
+
+// chunkSet records which chunks of an incoming transfer have been written
+type chunkSet []uint64
+
+// newChunkSet creates an empty set for a file of the given size. Empty files still
+// receive one empty chunk.
+func newChunkSet(size int64) chunkSet {
+	chunks := (size + chunkSize - 1) / chunkSize
+	if chunks == 0 {
+		chunks = 1
+	}
+	return make(chunkSet, (chunks+63)/64)
+}
+
+// add marks a chunk as written and reports whether it was new
+func (s chunkSet) add(index int) bool {
+	word, bit := index/64, uint(index%64)
+	if s[word]&(1<<bit) != 0 {
+		return false
+	}
+	s[word] |= 1 << bit
+	return true
+}
+
+// validChunk reports whether a chunk lies within a file of the given size
+func validChunk(size int64, index int, length int) bool {
+	if index < 0 {
+		return false
+	}
+	offset := int64(index) * chunkSize
+	return offset <= size && int64(length) <= size-offset && (length > 0 || size == 0)
+}
@@ -0,0 +1,94 @@
+package transfer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// History persists finished transfers together with their signed offers and receipts
+type History struct {
+	path    string
+	entries []Transfer
+	mutex   sync.RWMutex
+}
+
+// NewHistory creates a transfer history backed by the given file
+func NewHistory(path string) (*History, error) {
+	history := &History{
+		path:    path,
+		entries: make([]Transfer, 0),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return history, nil
+		}
+		return nil, fmt.Errorf("failed to read transfer history: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &history.entries); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal transfer history: %w", err)
+	}
+
+	return history, nil
+}
+
+// Record adds or updates the history entry for a transfer and saves the history
+func (h *History) Record(transfer *Transfer) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	entry := *transfer
+	entry.file = nil
+	entry.cancel = nil
+
+	replaced := false
+	for i := range h.entries {
+		if h.entries[i].ID == entry.ID && h.entries[i].Direction == entry.Direction {
+			h.entries[i] = entry
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		h.entries = append(h.entries, entry)
+	}
+
+	return h.save()
+}
+
+// Entries returns a copy of all recorded transfers
+func (h *History) Entries() []Transfer {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	entries := make([]Transfer, len(h.entries))
+	copy(entries, h.entries)
+	return entries
+}
+
+// save writes the history to disk
+func (h *History) save() error {
+	if h.path == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(h.path), 0755); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(h.entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal transfer history: %w", err)
+	}
+
+	if err := os.WriteFile(h.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write transfer history: %w", err)
+	}
+
+	return nil
+}
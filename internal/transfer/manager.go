@@ -9,14 +9,16 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"mime"
 	"os"
 	"path/filepath"
+	"shario/internal/config"
+	"shario/internal/identity"
 	"shario/internal/network"
 	"sync"
 	"time"
 
 	"github.com/libp2p/go-libp2p/core/peer"
-	"github.com/libp2p/go-libp2p/core/protocol"
 )
 
 // Transfer represents a file transfer
@@ -36,11 +38,20 @@ type Transfer struct {
 	StartTime    time.Time         `json:"start_time"`
 	EndTime      *time.Time        `json:"end_time,omitempty"`
 	Error        string            `json:"error,omitempty"`
+	Offer        *Offer            `json:"offer,omitempty"`
+	Receipt      *Receipt          `json:"receipt,omitempty"`
+	ShareToken   string            `json:"share_token,omitempty"`
+	Mode         os.FileMode       `json:"mode,omitempty"`
+	ModTime      time.Time         `json:"mod_time,omitempty"`
+	MIMEType     string            `json:"mime_type,omitempty"`
 
 	// Internal fields
 	file       *os.File
 	cancel     context.CancelFunc
 	lastUpdate time.Time
+	reserved   int64    // daily quota bytes reserved for this transfer and not yet received
+	decided    bool     // an incoming offer was accepted or rejected, so it can't be answered again
+	chunks     chunkSet // chunks of an incoming transfer written so far
 }
 
 // TransferStatus represents the status of a transfer
@@ -69,6 +80,12 @@ type TransferMessage struct {
 	Data map[string]interface{} `json:"data"`
 }
 
+// chunkSize is the number of file bytes carried by each data message
+const chunkSize = 1024 // 1KB chunks to avoid network message size limits
+
+// cancelReasonShutdown tells a peer that a transfer stopped because we are shutting down
+const cancelReasonShutdown = "shutdown"
+
 // Message types
 const (
 	MsgTypeOffer    = "offer"
@@ -78,38 +95,86 @@ const (
 	MsgTypeComplete = "complete"
 	MsgTypeCancel   = "cancel"
 	MsgTypeProgress = "progress"
+	MsgTypeReceipt  = "receipt"
+
+	MsgTypeShareRequest = "share_request"
+	MsgTypeShareDenied  = "share_denied"
+
+	// MsgTypeUnsupported answers a message type the receiver does not know, from transfer 1.1.0 on
+	MsgTypeUnsupported = "unsupported"
+)
+
+// Capabilities announced in our peer profile
+const (
+	CapabilitySignedOffers = "signed-offers" // offers carry a signature by the sender's identity key
+	CapabilityReceipts     = "receipts"      // the receiver confirms the checksum after a transfer
+	CapabilityShareLinks   = "share-links"   // one-time share tokens can be redeemed
 )
 
 // Manager handles file transfers
 type Manager struct {
 	network     *network.Manager
+	identity    *identity.Manager
+	history     *History
+	quotas      *quotaTracker
+	metadata    config.MetadataPolicy
 	transfers   map[string]*Transfer
-	mutex       sync.RWMutex
+	shares      map[string]*Share    // our published share tokens
+	redeeming   map[string]peer.ID   // share tokens we requested, by sharing peer
+	seenOffers  map[string]time.Time // verified offers by peer and transfer ID, until their timestamp goes stale
+	mutex       sync.RWMutex         // guards the maps and every stored transfer's fields
 	downloadDir string
 	maxFileSize int64
 
+	// Network event subscriptions
+	unsubscribes []func()
+
 	// Event handlers
 	onTransferUpdate func(*Transfer)
 	onTransferOffer  func(*Transfer) bool // returns true to accept
+	onShareDenied    func(token, reason string)
 }
 
 // New creates a new transfer manager
-func New(networkMgr *network.Manager) *Manager {
+func New(networkMgr *network.Manager, identityMgr *identity.Manager, cfg config.TransferConfig) *Manager {
 	homeDir, _ := os.UserHomeDir()
 	downloadDir := filepath.Join(homeDir, "Downloads", "Shario")
 
 	// Create download directory if it doesn't exist
 	os.MkdirAll(downloadDir, 0755)
 
+	// Load transfer history, starting empty if it is unreadable
+	historyPath := filepath.Join(homeDir, ".shario", "transfer_history.json")
+	history, err := NewHistory(historyPath)
+	if err != nil {
+		log.Printf("Failed to load transfer history: %v", err)
+		history = &History{path: historyPath}
+	}
+
 	mgr := &Manager{
 		network:     networkMgr,
+		identity:    identityMgr,
+		history:     history,
+		quotas:      newQuotaTracker(cfg),
+		metadata:    cfg.Metadata,
 		transfers:   make(map[string]*Transfer),
+		shares:      make(map[string]*Share),
+		redeeming:   make(map[string]peer.ID),
+		seenOffers:  make(map[string]time.Time),
 		downloadDir: downloadDir,
 		maxFileSize: 1024 * 1024 * 1024, // 1GB default limit
 	}
 
-	// Register as network event handler
-	networkMgr.AddEventHandler("transfer", mgr)
+	networkMgr.AddCapability(CapabilitySignedOffers)
+	networkMgr.AddCapability(CapabilityReceipts)
+	networkMgr.AddCapability(CapabilityShareLinks)
+
+	// Transfer messages from a peer are handled one at a time, but each arrives on its own
+	// stream, so chunks may come out of order. They are written at their own offsets.
+	mgr.unsubscribes = []func(){
+		networkMgr.SubscribePeerDisconnected(mgr.handlePeerDisconnected),
+		networkMgr.SubscribeMessages(network.TransferProtocol, mgr.handleMessage),
+	}
 
 	return mgr
 }
@@ -120,8 +185,29 @@ func (m *Manager) Start() error {
 	return nil
 }
 
+// SetDownloadDir sets the directory received files are written to
+func (m *Manager) SetDownloadDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create download directory: %w", err)
+	}
+
+	m.mutex.Lock()
+	m.downloadDir = dir
+	m.mutex.Unlock()
+	return nil
+}
+
 // SendFile initiates a file transfer to a peer
 func (m *Manager) SendFile(peerID peer.ID, filePath string) (*Transfer, error) {
+	transfer, err := m.offerFile(peerID, filePath, "")
+	if err != nil {
+		return nil, err
+	}
+	return m.snapshot(transfer), nil
+}
+
+// offerFile creates an outgoing transfer and sends its signed offer, optionally answering a share token
+func (m *Manager) offerFile(peerID peer.ID, filePath string, shareToken string) (*Transfer, error) {
 	log.Printf("📁 SendFile: Starting file transfer to peer %s, file: %s", peerID.String(), filePath)
 
 	// Check if file exists and get info
@@ -154,9 +240,20 @@ func (m *Manager) SendFile(peerID peer.ID, filePath string) (*Transfer, error) {
 		FilePath:   filePath,
 		Checksum:   checksum,
 		StartTime:  time.Now(),
+		ShareToken: shareToken,
+		Mode:       fileInfo.Mode().Perm(),
+		ModTime:    fileInfo.ModTime(),
+		MIMEType:   mime.TypeByExtension(filepath.Ext(fileInfo.Name())),
 		lastUpdate: time.Now(),
 	}
 
+	// Sign the offer so the receiver can prove who sent this file
+	offer, err := m.signOffer(transfer)
+	if err != nil {
+		return nil, err
+	}
+	transfer.Offer = offer
+
 	// Store transfer
 	m.mutex.Lock()
 	m.transfers[transfer.ID] = transfer
@@ -164,9 +261,7 @@ func (m *Manager) SendFile(peerID peer.ID, filePath string) (*Transfer, error) {
 
 	// Send transfer offer
 	if err := m.sendTransferOffer(transfer); err != nil {
-		transfer.Status = StatusFailed
-		transfer.Error = err.Error()
-		m.notifyTransferUpdate(transfer)
+		m.fail(transfer, err)
 		return nil, fmt.Errorf("failed to send transfer offer: %w", err)
 	}
 
@@ -177,36 +272,65 @@ func (m *Manager) SendFile(peerID peer.ID, filePath string) (*Transfer, error) {
 func (m *Manager) AcceptTransfer(transferID string) error {
 	log.Printf("📁 AcceptTransfer: Accepting transfer %s", transferID)
 
-	m.mutex.RLock()
+	// Take the offer out of pending before reserving, so a second accept can't charge the quota again
+	m.mutex.Lock()
 	transfer, exists := m.transfers[transferID]
-	m.mutex.RUnlock()
-
 	if !exists {
+		m.mutex.Unlock()
 		log.Printf("📁 AcceptTransfer: Transfer not found: %s", transferID)
 		return fmt.Errorf("transfer not found: %s", transferID)
 	}
 
 	if transfer.Direction != DirectionReceive {
+		m.mutex.Unlock()
 		log.Printf("📁 AcceptTransfer: Cannot accept outgoing transfer")
 		return fmt.Errorf("cannot accept outgoing transfer")
 	}
 
+	if transfer.decided || transfer.Status != StatusPending {
+		m.mutex.Unlock()
+		log.Printf("📁 AcceptTransfer: Transfer %s was already answered", transferID)
+		return fmt.Errorf("transfer %s is no longer pending", transferID)
+	}
+	transfer.decided = true
+	m.mutex.Unlock()
+
+	// Reserve the whole size against the daily quota, files we asked for through a share link are exempt
+	if transfer.ShareToken == "" {
+		if !m.quotas.reserve(transfer.PeerID, transfer.Size) {
+			m.stopTransfer(transfer, StatusCancelled, "daily quota exceeded")
+			m.autoReject(transfer.PeerID, transferID, ReasonDailyQuota)
+			m.notifyTransferUpdate(transfer)
+			return fmt.Errorf("daily quota of peer %s exceeded", transfer.PeerID)
+		}
+		m.mutex.Lock()
+		transfer.reserved = transfer.Size
+		m.mutex.Unlock()
+	}
+
 	// Create file for receiving
+	m.mutex.RLock()
 	filePath := filepath.Join(m.downloadDir, transfer.Filename)
+	m.mutex.RUnlock()
 	log.Printf("📁 AcceptTransfer: Creating file at %s", filePath)
 
 	file, err := os.Create(filePath)
 	if err != nil {
 		log.Printf("📁 AcceptTransfer: Failed to create file: %v", err)
+		m.stopTransfer(transfer, StatusFailed, err.Error())
+		m.notifyTransferUpdate(transfer)
 		return fmt.Errorf("failed to create file: %w", err)
 	}
 
 	log.Printf("📁 AcceptTransfer: File created successfully")
 
+	m.mutex.Lock()
 	transfer.file = file
+	transfer.chunks = newChunkSet(transfer.Size)
 	transfer.FilePath = filePath
 	transfer.Status = StatusActive
 	transfer.StartTime = time.Now()
+	m.mutex.Unlock()
 
 	// Send acceptance message
 	msg := TransferMessage{
@@ -219,6 +343,8 @@ func (m *Manager) AcceptTransfer(transferID string) error {
 	log.Printf("📁 AcceptTransfer: Sending acceptance message to peer %s", transfer.PeerID.String())
 	if err := m.sendMessage(transfer.PeerID, msg); err != nil {
 		log.Printf("📁 AcceptTransfer: Failed to send accept message: %v", err)
+		m.stopTransfer(transfer, StatusFailed, err.Error())
+		m.notifyTransferUpdate(transfer)
 		return fmt.Errorf("failed to send accept message: %w", err)
 	}
 	log.Printf("📁 AcceptTransfer: Acceptance message sent successfully")
@@ -229,27 +355,25 @@ func (m *Manager) AcceptTransfer(transferID string) error {
 
 // RejectTransfer rejects an incoming file transfer
 func (m *Manager) RejectTransfer(transferID string) error {
-	m.mutex.RLock()
+	m.mutex.Lock()
 	transfer, exists := m.transfers[transferID]
-	m.mutex.RUnlock()
-
 	if !exists {
+		m.mutex.Unlock()
 		return fmt.Errorf("transfer not found: %s", transferID)
 	}
 
+	if transfer.decided || transfer.Status != StatusPending {
+		m.mutex.Unlock()
+		return fmt.Errorf("transfer %s is no longer pending", transferID)
+	}
+	transfer.decided = true
 	transfer.Status = StatusCancelled
 	transfer.EndTime = &time.Time{}
 	*transfer.EndTime = time.Now()
+	m.mutex.Unlock()
 
 	// Send rejection message
-	msg := TransferMessage{
-		Type: MsgTypeReject,
-		Data: map[string]interface{}{
-			"transfer_id": transferID,
-		},
-	}
-
-	if err := m.sendMessage(transfer.PeerID, msg); err != nil {
+	if err := m.sendReject(transfer.PeerID, transferID, ReasonDeclined); err != nil {
 		return fmt.Errorf("failed to send reject message: %w", err)
 	}
 
@@ -270,17 +394,7 @@ func (m *Manager) CancelTransfer(transferID string) error {
 		return fmt.Errorf("transfer not found: %s", transferID)
 	}
 
-	if transfer.cancel != nil {
-		transfer.cancel()
-	}
-
-	transfer.Status = StatusCancelled
-	transfer.EndTime = &time.Time{}
-	*transfer.EndTime = time.Now()
-
-	if transfer.file != nil {
-		transfer.file.Close()
-	}
+	m.stopTransfer(transfer, StatusCancelled, "")
 
 	// Send cancel message
 	msg := TransferMessage{
@@ -305,7 +419,7 @@ func (m *Manager) GetTransfers() []*Transfer {
 
 	transfers := make([]*Transfer, 0, len(m.transfers))
 	for _, transfer := range m.transfers {
-		transfers = append(transfers, transfer)
+		transfers = append(transfers, transfer.copy())
 	}
 
 	return transfers
@@ -326,6 +440,25 @@ func (m *Manager) GetActiveTransfers() int {
 	return count
 }
 
+// GetMetadataPolicy returns which file attributes are applied to received files
+func (m *Manager) GetMetadataPolicy() config.MetadataPolicy {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.metadata
+}
+
+// SetMetadataPolicy sets which file attributes are applied to received files
+func (m *Manager) SetMetadataPolicy(policy config.MetadataPolicy) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.metadata = policy
+}
+
+// GetHistory returns all transfers recorded in the persistent history
+func (m *Manager) GetHistory() []Transfer {
+	return m.history.Entries()
+}
+
 // SetTransferUpdateHandler sets the callback for transfer updates
 func (m *Manager) SetTransferUpdateHandler(handler func(*Transfer)) {
 	m.onTransferUpdate = handler
@@ -336,13 +469,66 @@ func (m *Manager) SetTransferOfferHandler(handler func(*Transfer) bool) {
 	m.onTransferOffer = handler
 }
 
-// OnPeerConnected handles peer connection events
-func (m *Manager) OnPeerConnected(peer *network.Peer) {
-	// Implementation for peer connection handling
+// Stop cancels the running transfers, telling each peer why, records them in the history
+// and unsubscribes the transfer manager from network events. Cancel messages still unsent
+// when ctx is done are dropped.
+func (m *Manager) Stop(ctx context.Context) {
+	m.mutex.RLock()
+	var running []*Transfer
+	for _, transfer := range m.transfers {
+		switch transfer.Status {
+		case StatusPending, StatusActive, StatusPaused:
+			running = append(running, transfer)
+		}
+	}
+	m.mutex.RUnlock()
+
+	if len(running) > 0 {
+		log.Printf("📁 Stop: Cancelling %d running transfers", len(running))
+	}
+
+	var wg sync.WaitGroup
+	for _, transfer := range running {
+		m.stopTransfer(transfer, StatusCancelled, "cancelled on shutdown")
+		m.recordHistory(transfer)
+		m.notifyTransferUpdate(transfer)
+
+		wg.Add(1)
+		go func(transfer *Transfer) {
+			defer wg.Done()
+			msg := TransferMessage{
+				Type: MsgTypeCancel,
+				Data: map[string]interface{}{
+					"transfer_id": transfer.ID,
+					"reason":      cancelReasonShutdown,
+				},
+			}
+			if err := m.sendMessage(transfer.PeerID, msg); err != nil {
+				log.Printf("Failed to send cancel message: %v", err)
+			}
+		}(transfer)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Printf("⚠️ Stopped waiting for transfer cancellations: %v", ctx.Err())
+	}
+
+	for _, unsubscribe := range m.unsubscribes {
+		unsubscribe()
+	}
 }
 
-// OnPeerDisconnected handles peer disconnection events
-func (m *Manager) OnPeerDisconnected(peerID peer.ID) {
+// handlePeerDisconnected cancels the active transfers with a disconnected peer
+func (m *Manager) handlePeerDisconnected(event network.PeerDisconnectedEvent) {
+	peerID := event.PeerID
+
 	// Cancel any active transfers with this peer
 	m.mutex.RLock()
 	var affectedTransfers []*Transfer
@@ -358,14 +544,10 @@ func (m *Manager) OnPeerDisconnected(peerID peer.ID) {
 	}
 }
 
-// OnMessage handles incoming messages
-func (m *Manager) OnMessage(peerID peer.ID, protocol protocol.ID, data []byte) {
-	log.Printf("📁 Transfer OnMessage: protocol=%s, peer=%s, size=%d", protocol, peerID.String(), len(data))
-
-	if protocol != network.TransferProtocol {
-		log.Printf("📁 Transfer: Ignoring non-transfer protocol: %s", protocol)
-		return
-	}
+// handleMessage handles incoming transfer messages
+func (m *Manager) handleMessage(event network.MessageEvent) {
+	peerID, data := event.PeerID, event.Data
+	log.Printf("📁 Transfer message: peer=%s, size=%d", peerID.String(), len(data))
 
 	var msg TransferMessage
 	if err := json.Unmarshal(data, &msg); err != nil {
@@ -408,22 +590,102 @@ func (m *Manager) OnMessage(peerID peer.ID, protocol protocol.ID, data []byte) {
 	case MsgTypeComplete:
 		log.Printf("📁 Transfer: Handling transfer complete")
 		m.handleTransferComplete(peerID, msg)
+	case MsgTypeReceipt:
+		log.Printf("📁 Transfer: Handling transfer receipt")
+		m.handleTransferReceipt(peerID, msg)
+	case MsgTypeShareRequest:
+		log.Printf("📁 Transfer: Handling share request")
+		m.handleShareRequest(peerID, msg)
+	case MsgTypeShareDenied:
+		log.Printf("📁 Transfer: Handling share denial")
+		m.handleShareDenied(peerID, msg)
+	case MsgTypeUnsupported:
+		log.Printf("📁 Transfer: Handling unsupported reply")
+		m.handleUnsupported(peerID, msg)
 	default:
 		log.Printf("📁 Transfer: Unknown transfer message type: %s", msg.Type)
+		m.replyUnsupported(event, msg)
+	}
+}
+
+// replyUnsupported tells the sender we do not know a message type, when its protocol version
+// understands the reply. The transfer ID lets the sender fail the transfer it belongs to.
+func (m *Manager) replyUnsupported(event network.MessageEvent, msg TransferMessage) {
+	if !network.SupportsReplies(event) {
+		return
+	}
+
+	reply := TransferMessage{
+		Type: MsgTypeUnsupported,
+		Data: map[string]interface{}{
+			"type":    msg.Type,
+			"version": string(event.Version),
+		},
+	}
+	if transferID, ok := msg.Data["transfer_id"].(string); ok {
+		reply.Data["transfer_id"] = transferID
+	}
+
+	if err := m.sendMessage(event.PeerID, reply); err != nil {
+		log.Printf("📁 Transfer: Failed to send unsupported reply to peer %s: %v", event.PeerID, err)
+	}
+}
+
+// handleUnsupported handles a peer telling us it does not know a message type we sent,
+// failing the transfer the message belonged to
+func (m *Manager) handleUnsupported(peerID peer.ID, msg TransferMessage) {
+	msgType, _ := msg.Data["type"].(string)
+	version, _ := msg.Data["version"].(string)
+	log.Printf("⚠️ Peer %s does not support transfer message type %q (speaks %s)", peerID, msgType, version)
+
+	transferID, _ := msg.Data["transfer_id"].(string)
+	m.mutex.RLock()
+	transfer, exists := m.transfers[transferID]
+	m.mutex.RUnlock()
+
+	if !exists || transfer.PeerID != peerID {
+		return
+	}
+
+	m.mutex.RLock()
+	running := transfer.Status == StatusActive || transfer.Status == StatusPending || transfer.Status == StatusPaused
+	m.mutex.RUnlock()
+	if !running {
+		return
 	}
+
+	m.stopTransfer(transfer, StatusFailed, fmt.Sprintf("peer does not support %s messages", msgType))
+	m.recordHistory(transfer)
+	m.notifyTransferUpdate(transfer)
 }
 
-// sendTransferOffer sends a transfer offer to a peer
+// sendTransferOffer sends a signed transfer offer to a peer
 func (m *Manager) sendTransferOffer(transfer *Transfer) error {
+	offer := transfer.Offer
 	msg := TransferMessage{
 		Type: MsgTypeOffer,
 		Data: map[string]interface{}{
-			"transfer_id": transfer.ID,
-			"filename":    transfer.Filename,
-			"size":        transfer.Size,
-			"checksum":    transfer.Checksum,
+			"transfer_id": offer.TransferID,
+			"filename":    offer.Filename,
+			"size":        offer.Size,
+			"checksum":    offer.Checksum,
+			"sender_id":   offer.SenderID,
+			"timestamp":   offer.Timestamp,
+			"signature":   base64.StdEncoding.EncodeToString(offer.Signature),
 		},
 	}
+	if offer.ShareToken != "" {
+		msg.Data["share_token"] = offer.ShareToken
+	}
+	if offer.Mode != 0 {
+		msg.Data["mode"] = offer.Mode
+	}
+	if offer.ModTime != 0 {
+		msg.Data["mod_time"] = offer.ModTime
+	}
+	if offer.MIMEType != "" {
+		msg.Data["mime_type"] = offer.MIMEType
+	}
 
 	return m.sendMessage(transfer.PeerID, msg)
 }
@@ -441,20 +703,62 @@ func (m *Manager) sendMessage(peerID peer.ID, msg TransferMessage) error {
 
 // handleTransferOffer handles an incoming transfer offer
 func (m *Manager) handleTransferOffer(peerID peer.ID, msg TransferMessage) {
-	data := msg.Data
 	log.Printf("📁 handleTransferOffer: Received offer from peer %s", peerID.String())
 
+	offer, err := parseOffer(msg.Data)
+	if err != nil {
+		log.Printf("📁 handleTransferOffer: Malformed offer from peer %s: %v", peerID.String(), err)
+		return
+	}
+
 	transfer := &Transfer{
-		ID:         data["transfer_id"].(string),
-		Filename:   data["filename"].(string),
-		Size:       int64(data["size"].(float64)),
-		Checksum:   data["checksum"].(string),
+		ID:         offer.TransferID,
+		Filename:   filepath.Base(offer.Filename),
+		Size:       offer.Size,
+		Checksum:   offer.Checksum,
 		Status:     StatusPending,
 		Direction:  DirectionReceive,
 		PeerID:     peerID,
 		StartTime:  time.Now(),
+		Offer:      offer,
+		ShareToken: offer.ShareToken,
+		Mode:       os.FileMode(offer.Mode).Perm(),
+		MIMEType:   offer.MIMEType,
 		lastUpdate: time.Now(),
 	}
+	if offer.ModTime != 0 {
+		transfer.ModTime = time.Unix(offer.ModTime, 0)
+	}
+
+	// Refuse offers that are not signed by the sending peer
+	if err := m.verifyOffer(peerID, offer); err != nil {
+		log.Printf("📁 handleTransferOffer: Invalid signature on offer %s: %v", transfer.ID, err)
+		m.autoReject(peerID, transfer.ID, ReasonInvalidSignature)
+		return
+	}
+
+	// Refuse stale offers and replays of a signed offer we already handled
+	if err := m.checkOfferFresh(peerID, offer); err != nil {
+		log.Printf("📁 handleTransferOffer: Refusing offer %s: %v", transfer.ID, err)
+		m.autoReject(peerID, transfer.ID, ReasonStaleOffer)
+		return
+	}
+
+	// Files we asked for through a share link are accepted without prompting
+	if m.claimRedemption(peerID, offer.ShareToken) {
+		log.Printf("📁 handleTransferOffer: Accepting redeemed share %s", offer.ShareToken)
+		m.mutex.Lock()
+		m.transfers[transfer.ID] = transfer
+		m.mutex.Unlock()
+		go m.AcceptTransfer(transfer.ID)
+		return
+	}
+
+	// Enforce per-peer receive limits before bothering the user
+	if reason := m.quotas.checkOffer(peerID, transfer.Size, m.countPendingOffers(peerID)); reason != "" {
+		m.autoReject(peerID, transfer.ID, reason)
+		return
+	}
 
 	log.Printf("📁 handleTransferOffer: Transfer details - ID: %s, File: %s, Size: %d", transfer.ID, transfer.Filename, transfer.Size)
 
@@ -465,22 +769,66 @@ func (m *Manager) handleTransferOffer(peerID peer.ID, msg TransferMessage) {
 
 	// Notify UI
 	if m.onTransferOffer != nil {
-		log.Printf("📁 handleTransferOffer: Showing transfer offer dialog to user")
-		accepted := m.onTransferOffer(transfer)
-		log.Printf("📁 handleTransferOffer: User decision: %t", accepted)
-
-		if accepted {
-			log.Printf("📁 handleTransferOffer: User accepted, calling AcceptTransfer")
-			go m.AcceptTransfer(transfer.ID)
-		} else {
-			log.Printf("📁 handleTransferOffer: User rejected, calling RejectTransfer")
-			go m.RejectTransfer(transfer.ID)
-		}
+		// The user may take a while to answer, keep handling the peer's other messages meanwhile
+		go m.askOffer(transfer)
 	} else {
 		log.Printf("📁 handleTransferOffer: No transfer offer handler set!")
 	}
 }
 
+// askOffer asks the user about an incoming offer and accepts or rejects it
+func (m *Manager) askOffer(transfer *Transfer) {
+	log.Printf("📁 handleTransferOffer: Showing transfer offer dialog to user")
+	accepted := m.onTransferOffer(m.snapshot(transfer))
+	log.Printf("📁 handleTransferOffer: User decision: %t", accepted)
+
+	if accepted {
+		log.Printf("📁 handleTransferOffer: User accepted, calling AcceptTransfer")
+		m.AcceptTransfer(transfer.ID)
+	} else {
+		log.Printf("📁 handleTransferOffer: User rejected, calling RejectTransfer")
+		m.RejectTransfer(transfer.ID)
+	}
+}
+
+// countPendingOffers returns the number of incoming offers from a peer awaiting a decision
+func (m *Manager) countPendingOffers(peerID peer.ID) int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	count := 0
+	for _, transfer := range m.transfers {
+		if transfer.PeerID == peerID && transfer.Direction == DirectionReceive && transfer.Status == StatusPending {
+			count++
+		}
+	}
+
+	return count
+}
+
+// autoReject rejects an offer without asking the user and flags the offending peer
+func (m *Manager) autoReject(peerID peer.ID, transferID string, reason RejectReason) {
+	log.Printf("📁 Auto-rejecting offer %s from peer %s: %s", transferID, peerID.String(), reason)
+	m.network.FlagPeer(peerID, string(reason))
+
+	if err := m.sendReject(peerID, transferID, reason); err != nil {
+		log.Printf("📁 Failed to send reject message: %v", err)
+	}
+}
+
+// sendReject sends a rejection with a reason code to a peer
+func (m *Manager) sendReject(peerID peer.ID, transferID string, reason RejectReason) error {
+	msg := TransferMessage{
+		Type: MsgTypeReject,
+		Data: map[string]interface{}{
+			"transfer_id": transferID,
+			"reason":      string(reason),
+		},
+	}
+
+	return m.sendMessage(peerID, msg)
+}
+
 // handleTransferAccept handles transfer acceptance
 func (m *Manager) handleTransferAccept(peerID peer.ID, msg TransferMessage) {
 	transferID := msg.Data["transfer_id"].(string)
@@ -496,7 +844,9 @@ func (m *Manager) handleTransferAccept(peerID peer.ID, msg TransferMessage) {
 	}
 
 	log.Printf("📁 handleTransferAccept: Found transfer, starting file send")
+	m.mutex.Lock()
 	transfer.Status = StatusActive
+	m.mutex.Unlock()
 	m.notifyTransferUpdate(transfer)
 
 	// Start sending file
@@ -506,6 +856,7 @@ func (m *Manager) handleTransferAccept(peerID peer.ID, msg TransferMessage) {
 // handleTransferReject handles transfer rejection
 func (m *Manager) handleTransferReject(peerID peer.ID, msg TransferMessage) {
 	transferID := msg.Data["transfer_id"].(string)
+	reason, _ := msg.Data["reason"].(string)
 
 	m.mutex.RLock()
 	transfer, exists := m.transfers[transferID]
@@ -515,9 +866,14 @@ func (m *Manager) handleTransferReject(peerID peer.ID, msg TransferMessage) {
 		return
 	}
 
+	m.mutex.Lock()
+	if reason != "" && RejectReason(reason) != ReasonDeclined {
+		transfer.Error = fmt.Sprintf("rejected by peer: %s", reason)
+	}
 	transfer.Status = StatusCancelled
 	transfer.EndTime = &time.Time{}
 	*transfer.EndTime = time.Now()
+	m.mutex.Unlock()
 
 	m.notifyTransferUpdate(transfer)
 }
@@ -525,6 +881,7 @@ func (m *Manager) handleTransferReject(peerID peer.ID, msg TransferMessage) {
 // handleTransferCancel handles transfer cancellation
 func (m *Manager) handleTransferCancel(peerID peer.ID, msg TransferMessage) {
 	transferID := msg.Data["transfer_id"].(string)
+	reason, _ := msg.Data["reason"].(string)
 
 	m.mutex.RLock()
 	transfer, exists := m.transfers[transferID]
@@ -534,30 +891,57 @@ func (m *Manager) handleTransferCancel(peerID peer.ID, msg TransferMessage) {
 		return
 	}
 
+	// A reason means the peer aborted because of an error rather than by choice
+	if reason != "" {
+		m.stopTransfer(transfer, StatusFailed, fmt.Sprintf("cancelled by peer: %s", reason))
+		m.recordHistory(transfer)
+	} else {
+		m.stopTransfer(transfer, StatusCancelled, "")
+	}
+
+	m.notifyTransferUpdate(transfer)
+}
+
+// stopTransfer ends a transfer with the given status and releases its file handle
+func (m *Manager) stopTransfer(transfer *Transfer, status TransferStatus, errMsg string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
 	if transfer.cancel != nil {
 		transfer.cancel()
 	}
 
-	transfer.Status = StatusCancelled
-	transfer.EndTime = &time.Time{}
-	*transfer.EndTime = time.Now()
+	transfer.Status = status
+	if errMsg != "" {
+		transfer.Error = errMsg
+	}
+	now := time.Now()
+	transfer.EndTime = &now
 
 	if transfer.file != nil {
 		transfer.file.Close()
+		transfer.file = nil
 	}
+	m.releaseQuotaLocked(transfer)
+}
 
-	m.notifyTransferUpdate(transfer)
+// releaseQuotaLocked returns the unreceived part of a transfer's quota reservation.
+// The caller must hold the manager lock.
+func (m *Manager) releaseQuotaLocked(transfer *Transfer) {
+	if transfer.reserved > 0 {
+		m.quotas.release(transfer.PeerID, transfer.reserved)
+		transfer.reserved = 0
+	}
 }
 
 // handleTransferComplete handles transfer completion
 func (m *Manager) handleTransferComplete(peerID peer.ID, msg TransferMessage) {
 	transferID := msg.Data["transfer_id"].(string)
 
-	m.mutex.RLock()
+	m.mutex.Lock()
 	transfer, exists := m.transfers[transferID]
-	m.mutex.RUnlock()
-
 	if !exists {
+		m.mutex.Unlock()
 		return
 	}
 
@@ -568,7 +952,9 @@ func (m *Manager) handleTransferComplete(peerID peer.ID, msg TransferMessage) {
 
 	if transfer.file != nil {
 		transfer.file.Close()
+		transfer.file = nil
 	}
+	m.mutex.Unlock()
 
 	m.notifyTransferUpdate(transfer)
 }
@@ -580,9 +966,7 @@ func (m *Manager) sendFile(transfer *Transfer) {
 	file, err := os.Open(transfer.FilePath)
 	if err != nil {
 		log.Printf("📁 sendFile: Failed to open file: %v", err)
-		transfer.Status = StatusFailed
-		transfer.Error = err.Error()
-		m.notifyTransferUpdate(transfer)
+		m.fail(transfer, err)
 		return
 	}
 	defer file.Close()
@@ -591,28 +975,53 @@ func (m *Manager) sendFile(transfer *Transfer) {
 	fileInfo, err := file.Stat()
 	if err != nil {
 		log.Printf("📁 sendFile: Failed to stat file: %v", err)
-		transfer.Status = StatusFailed
-		transfer.Error = err.Error()
-		m.notifyTransferUpdate(transfer)
+		m.fail(transfer, err)
 		return
 	}
 
 	fileSize := fileInfo.Size()
 	log.Printf("📁 sendFile: File size: %d bytes", fileSize)
 
+	// Allow either side to stop the transfer between chunks
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m.mutex.Lock()
+	if transfer.Status != StatusActive {
+		m.mutex.Unlock()
+		log.Printf("📁 sendFile: Transfer %s was stopped before sending began", transfer.ID)
+		return
+	}
+	transfer.cancel = cancel
+	m.mutex.Unlock()
+
+	// An empty file still needs a final chunk so the receiver can complete
+	if fileSize == 0 {
+		if err := m.sendFileChunk(transfer, 0, nil, true); err != nil {
+			log.Printf("📁 sendFile: Failed to send empty file: %v", err)
+			m.fail(transfer, err)
+			return
+		}
+	}
+
 	// Send file in chunks
-	const chunkSize = 1024 // 1KB chunks to avoid network message size limits
 	buffer := make([]byte, chunkSize)
 	var totalSent int64 = 0
 	chunkIndex := 0
 
 	for {
-		bytesRead, err := file.Read(buffer)
+		if ctx.Err() != nil {
+			log.Printf("📁 sendFile: Transfer %s cancelled after %d bytes", transfer.ID, totalSent)
+			return
+		}
+
+		bytesRead, err := io.ReadFull(file, buffer)
+		if err == io.ErrUnexpectedEOF {
+			err = nil
+		}
 		if err != nil && err != io.EOF {
 			log.Printf("📁 sendFile: Failed to read file: %v", err)
-			transfer.Status = StatusFailed
-			transfer.Error = err.Error()
-			m.notifyTransferUpdate(transfer)
+			m.fail(transfer, err)
 			return
 		}
 
@@ -623,18 +1032,23 @@ func (m *Manager) sendFile(transfer *Transfer) {
 		// Send this chunk
 		chunk := buffer[:bytesRead]
 		if err := m.sendFileChunk(transfer, chunkIndex, chunk, totalSent+int64(bytesRead) == fileSize); err != nil {
+			if ctx.Err() != nil {
+				log.Printf("📁 sendFile: Transfer %s cancelled after %d bytes", transfer.ID, totalSent)
+				return
+			}
 			log.Printf("📁 sendFile: Failed to send chunk %d: %v", chunkIndex, err)
-			transfer.Status = StatusFailed
-			transfer.Error = err.Error()
-			m.notifyTransferUpdate(transfer)
+			m.fail(transfer, err)
 			return
 		}
 
 		totalSent += int64(bytesRead)
+		progress := float64(totalSent) * 100.0 / float64(fileSize)
+		m.mutex.Lock()
 		transfer.Transferred = totalSent
-		transfer.Progress = float64(totalSent) * 100.0 / float64(fileSize)
+		transfer.Progress = progress
+		m.mutex.Unlock()
 
-		log.Printf("📁 sendFile: Sent chunk %d, %d bytes, progress: %.1f%%", chunkIndex, bytesRead, transfer.Progress)
+		log.Printf("📁 sendFile: Sent chunk %d, %d bytes, progress: %.1f%%", chunkIndex, bytesRead, progress)
 
 		// Update progress
 		m.notifyTransferUpdate(transfer)
@@ -642,12 +1056,21 @@ func (m *Manager) sendFile(transfer *Transfer) {
 		chunkIndex++
 	}
 
+	// The receiver may have aborted while the last chunk was in flight
+	m.mutex.Lock()
+	if ctx.Err() != nil {
+		m.mutex.Unlock()
+		return
+	}
+
 	log.Printf("📁 sendFile: File transfer completed, total sent: %d bytes", totalSent)
 	transfer.Status = StatusCompleted
 	transfer.Progress = 100.0
 	now := time.Now()
 	transfer.EndTime = &now
+	m.mutex.Unlock()
 
+	m.recordHistory(transfer)
 	m.notifyTransferUpdate(transfer)
 }
 
@@ -669,11 +1092,55 @@ func (m *Manager) calculateChecksum(filePath string) (string, error) {
 
 // notifyTransferUpdate notifies about transfer updates
 func (m *Manager) notifyTransferUpdate(transfer *Transfer) {
+	snapshot := m.snapshot(transfer)
+	m.updateProtection(snapshot)
+	m.settleShare(snapshot)
+
 	if m.onTransferUpdate != nil {
-		m.onTransferUpdate(transfer)
+		m.onTransferUpdate(snapshot)
 	}
 }
 
+// updateProtection keeps the connection to a peer open while a transfer with it is running
+func (m *Manager) updateProtection(transfer *Transfer) {
+	tag := "transfer-" + transfer.ID
+	switch transfer.Status {
+	case StatusPending:
+	case StatusActive, StatusPaused:
+		m.network.ProtectPeer(transfer.PeerID, tag)
+	default:
+		m.network.UnprotectPeer(transfer.PeerID, tag)
+	}
+}
+
+// fail marks a transfer as failed and notifies about it
+func (m *Manager) fail(transfer *Transfer, err error) {
+	m.mutex.Lock()
+	transfer.Status = StatusFailed
+	transfer.Error = err.Error()
+	now := time.Now()
+	transfer.EndTime = &now
+	m.releaseQuotaLocked(transfer)
+	m.mutex.Unlock()
+
+	m.notifyTransferUpdate(transfer)
+}
+
+// snapshot returns a copy of a transfer that can be read without holding the lock
+func (m *Manager) snapshot(transfer *Transfer) *Transfer {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return transfer.copy()
+}
+
+// copy returns the exported state of a transfer, the caller must hold the manager lock
+func (t *Transfer) copy() *Transfer {
+	c := *t
+	c.file = nil
+	c.cancel = nil
+	return &c
+}
+
 // sendFileChunk sends a file chunk to a peer
 func (m *Manager) sendFileChunk(transfer *Transfer, chunkIndex int, data []byte, isLast bool) error {
 	log.Printf("📁 sendFileChunk: Sending chunk %d, size: %d bytes, isLast: %t", chunkIndex, len(data), isLast)
@@ -706,10 +1173,15 @@ func (m *Manager) sendFileChunk(transfer *Transfer, chunkIndex int, data []byte,
 // handleTransferData handles incoming file data chunks
 func (m *Manager) handleTransferData(peerID peer.ID, msg TransferMessage) {
 	data := msg.Data
-	transferID := data["transfer_id"].(string)
-	chunkIndex := int(data["chunk_index"].(float64))
-	encodedData := data["data"].(string)
-	isLast := data["is_last"].(bool)
+	transferID, _ := data["transfer_id"].(string)
+	index, indexOK := data["chunk_index"].(float64)
+	encodedData, dataOK := data["data"].(string)
+	isLast, _ := data["is_last"].(bool)
+	if transferID == "" || !indexOK || !dataOK {
+		log.Printf("📁 handleTransferData: Malformed data message from peer %s", peerID.String())
+		return
+	}
+	chunkIndex := int(index)
 
 	// Decode base64 data
 	chunkData, err := base64.StdEncoding.DecodeString(encodedData)
@@ -729,42 +1201,209 @@ func (m *Manager) handleTransferData(peerID peer.ID, msg TransferMessage) {
 		return
 	}
 
-	if transfer.file == nil {
-		log.Printf("📁 handleTransferData: No file handle for transfer: %s", transferID)
+	// Chunks are delivered concurrently, so writes are placed by offset
+	m.mutex.Lock()
+	if transfer.Status != StatusActive || transfer.file == nil || transfer.PeerID != peerID {
+		m.mutex.Unlock()
+		log.Printf("📁 handleTransferData: Transfer %s is not receiving, dropping chunk %d", transferID, chunkIndex)
+		return
+	}
+
+	// A chunk outside the offered size would grow the file past the size we accepted
+	if float64(chunkIndex) != index || !validChunk(transfer.Size, chunkIndex, len(chunkData)) {
+		m.mutex.Unlock()
+		log.Printf("📁 handleTransferData: Chunk %d of %d bytes is outside transfer %s", chunkIndex, len(chunkData), transferID)
+		m.stopTransfer(transfer, StatusFailed, "peer sent a chunk outside the file")
+		m.sendMessage(peerID, TransferMessage{
+			Type: MsgTypeCancel,
+			Data: map[string]interface{}{
+				"transfer_id": transferID,
+				"reason":      "invalid_chunk",
+			},
+		})
+		m.recordHistory(transfer)
+		m.notifyTransferUpdate(transfer)
+		return
+	}
+
+	// Repeated chunks are written once and counted once
+	if !transfer.chunks.add(chunkIndex) {
+		m.mutex.Unlock()
+		log.Printf("📁 handleTransferData: Ignoring duplicate chunk %d of transfer %s", chunkIndex, transferID)
 		return
 	}
 
 	// Write chunk to file
-	bytesWritten, err := transfer.file.Write(chunkData)
+	bytesWritten, err := transfer.file.WriteAt(chunkData, int64(chunkIndex)*chunkSize)
 	if err != nil {
 		log.Printf("📁 handleTransferData: Failed to write chunk: %v", err)
 		transfer.Status = StatusFailed
 		transfer.Error = err.Error()
 		transfer.file.Close()
 		transfer.file = nil
+		m.releaseQuotaLocked(transfer)
+		m.mutex.Unlock()
 		m.notifyTransferUpdate(transfer)
 		return
 	}
 
 	transfer.Transferred += int64(bytesWritten)
-	transfer.Progress = float64(transfer.Transferred) * 100.0 / float64(transfer.Size)
+	transfer.reserved -= int64(bytesWritten)
+	if transfer.reserved < 0 {
+		transfer.reserved = 0
+	}
+	if transfer.Size > 0 {
+		transfer.Progress = float64(transfer.Transferred) * 100.0 / float64(transfer.Size)
+	}
+	transferred, progress := transfer.Transferred, transfer.Progress
+
+	// Close the file once every byte has arrived so no later chunk can touch it
+	complete := transferred >= transfer.Size
+	if complete {
+		transfer.file.Close()
+		transfer.file = nil
+	}
+	m.mutex.Unlock()
 
 	log.Printf("📁 handleTransferData: Wrote %d bytes, total: %d/%d, progress: %.1f%%",
-		bytesWritten, transfer.Transferred, transfer.Size, transfer.Progress)
+		bytesWritten, transferred, transfer.Size, progress)
 
 	m.notifyTransferUpdate(transfer)
 
-	// If this is the last chunk, complete the transfer
-	if isLast {
+	// Verify and complete the transfer
+	if complete {
+		checksum, err := m.calculateChecksum(transfer.FilePath)
+		if err != nil || checksum != transfer.Checksum {
+			log.Printf("📁 handleTransferData: Checksum verification failed for %s", transferID)
+			m.fail(transfer, fmt.Errorf("checksum verification failed"))
+			m.sendMessage(peerID, TransferMessage{
+				Type: MsgTypeCancel,
+				Data: map[string]interface{}{
+					"transfer_id": transferID,
+					"reason":      "checksum_mismatch",
+				},
+			})
+			m.recordHistory(transfer)
+			return
+		}
+
 		log.Printf("📁 handleTransferData: Transfer completed: %s", transferID)
+		m.mutex.Lock()
 		transfer.Status = StatusCompleted
 		transfer.Progress = 100.0
 		now := time.Now()
 		transfer.EndTime = &now
+		m.mutex.Unlock()
 
-		transfer.file.Close()
-		transfer.file = nil
+		m.applyMetadata(transfer)
 
+		m.sendReceipt(transfer)
+		m.recordHistory(transfer)
 		m.notifyTransferUpdate(transfer)
 	}
 }
+
+// applyMetadata applies the offered file attributes allowed by the metadata policy
+func (m *Manager) applyMetadata(transfer *Transfer) {
+	policy := m.GetMetadataPolicy()
+
+	if transfer.Mode != 0 && (policy.Permissions || policy.Executable) {
+		fileInfo, err := os.Stat(transfer.FilePath)
+		if err != nil {
+			log.Printf("📁 applyMetadata: Failed to stat %s: %v", transfer.FilePath, err)
+			return
+		}
+
+		mode := fileInfo.Mode().Perm()
+		if policy.Permissions {
+			mode = transfer.Mode &^ 0111
+		}
+		if policy.Executable {
+			mode |= transfer.Mode & 0111
+		}
+
+		// The file was created with 0666 minus our umask. A sender can never make it group or
+		// world writable, lift the umask or lock us out, execute bits follow the read bits.
+		umask := 0666 &^ fileInfo.Mode().Perm()
+		umask |= (umask & 0444) >> 2
+		mode = mode&0755&^umask | 0600
+
+		if err := os.Chmod(transfer.FilePath, mode); err != nil {
+			log.Printf("📁 applyMetadata: Failed to set permissions on %s: %v", transfer.FilePath, err)
+		}
+	}
+
+	if policy.ModTime && !transfer.ModTime.IsZero() {
+		if err := os.Chtimes(transfer.FilePath, time.Now(), transfer.ModTime); err != nil {
+			log.Printf("📁 applyMetadata: Failed to set modification time on %s: %v", transfer.FilePath, err)
+		}
+	}
+}
+
+// sendReceipt signs a receipt for a verified transfer and returns it to the sender
+func (m *Manager) sendReceipt(transfer *Transfer) {
+	receipt, err := m.signReceipt(transfer)
+	if err != nil {
+		log.Printf("📁 sendReceipt: Failed to sign receipt for %s: %v", transfer.ID, err)
+		return
+	}
+
+	m.mutex.Lock()
+	transfer.Receipt = receipt
+	m.mutex.Unlock()
+
+	msg := TransferMessage{
+		Type: MsgTypeReceipt,
+		Data: map[string]interface{}{
+			"transfer_id": receipt.TransferID,
+			"filename":    receipt.Filename,
+			"size":        receipt.Size,
+			"checksum":    receipt.Checksum,
+			"sender_id":   receipt.SenderID,
+			"receiver_id": receipt.ReceiverID,
+			"received_at": receipt.ReceivedAt,
+			"signature":   base64.StdEncoding.EncodeToString(receipt.Signature),
+		},
+	}
+
+	if err := m.sendMessage(transfer.PeerID, msg); err != nil {
+		log.Printf("📁 sendReceipt: Failed to send receipt for %s: %v", transfer.ID, err)
+	}
+}
+
+// handleTransferReceipt handles a signed delivery receipt from the receiver
+func (m *Manager) handleTransferReceipt(peerID peer.ID, msg TransferMessage) {
+	receipt, err := parseReceipt(msg.Data)
+	if err != nil {
+		log.Printf("📁 handleTransferReceipt: Malformed receipt from peer %s: %v", peerID.String(), err)
+		return
+	}
+
+	m.mutex.RLock()
+	transfer, exists := m.transfers[receipt.TransferID]
+	m.mutex.RUnlock()
+
+	if !exists || transfer.Direction != DirectionSend || transfer.PeerID != peerID {
+		log.Printf("📁 handleTransferReceipt: No matching outgoing transfer: %s", receipt.TransferID)
+		return
+	}
+
+	if err := m.verifyReceipt(peerID, transfer, receipt); err != nil {
+		log.Printf("📁 handleTransferReceipt: Rejecting receipt for %s: %v", transfer.ID, err)
+		return
+	}
+
+	log.Printf("📁 handleTransferReceipt: Verified receipt for %s from peer %s", transfer.ID, peerID.String())
+	m.mutex.Lock()
+	transfer.Receipt = receipt
+	m.mutex.Unlock()
+	m.recordHistory(transfer)
+	m.notifyTransferUpdate(transfer)
+}
+
+// recordHistory stores a finished transfer in the persistent history
+func (m *Manager) recordHistory(transfer *Transfer) {
+	if err := m.history.Record(m.snapshot(transfer)); err != nil {
+		log.Printf("Failed to record transfer history: %v", err)
+	}
+}
@@ -0,0 +1,616 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"shario/internal/config"
+	"shario/internal/network"
+	"shario/internal/network/nettest"
+	"sync"
+	"testing"
+	"time"
+)
+
+const waitTimeout = 20 * time.Second
+
+func TestMain(m *testing.M) {
+	// The managers log every chunk, which drowns test output
+	if os.Getenv("SHARIO_TEST_LOG") == "" {
+		log.SetOutput(io.Discard)
+	}
+	os.Exit(m.Run())
+}
+
+// recorder collects the status transitions a manager reports for each transfer
+type recorder struct {
+	mutex     sync.Mutex
+	statuses  map[string][]TransferStatus
+	transfers map[string]*Transfer
+	progress  chan string // receives a transfer ID whenever bytes move
+	ended     chan string // receives a transfer ID whenever it completes, fails or is cancelled
+}
+
+func newRecorder() *recorder {
+	return &recorder{
+		statuses:  make(map[string][]TransferStatus),
+		transfers: make(map[string]*Transfer),
+		progress:  make(chan string, 1),
+		ended:     make(chan string, 64),
+	}
+}
+
+// update records a transfer's status, collapsing repeated progress updates
+func (r *recorder) update(transfer *Transfer) {
+	r.mutex.Lock()
+	seq := r.statuses[transfer.ID]
+	if len(seq) == 0 || seq[len(seq)-1] != transfer.Status {
+		r.statuses[transfer.ID] = append(seq, transfer.Status)
+	}
+	r.transfers[transfer.ID] = transfer
+	moved := transfer.Transferred > 0
+	r.mutex.Unlock()
+
+	if moved {
+		select {
+		case r.progress <- transfer.ID:
+		default:
+		}
+	}
+
+	switch transfer.Status {
+	case StatusCompleted, StatusFailed, StatusCancelled:
+		select {
+		case r.ended <- transfer.ID:
+		default:
+		}
+	}
+}
+
+// sequence returns the recorded statuses of a transfer
+func (r *recorder) sequence(id string) []TransferStatus {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]TransferStatus(nil), r.statuses[id]...)
+}
+
+// latest returns the most recent snapshot reported for a transfer
+func (r *recorder) latest(id string) *Transfer {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.transfers[id]
+}
+
+// last returns the most recently recorded status of a transfer
+func (r *recorder) last(id string) TransferStatus {
+	seq := r.sequence(id)
+	if len(seq) == 0 {
+		return ""
+	}
+	return seq[len(seq)-1]
+}
+
+// waitEnded blocks until the transfer completes, fails or is cancelled and returns its final state
+func (r *recorder) waitEnded(t *testing.T, id string) *Transfer {
+	t.Helper()
+
+	timeout := time.After(waitTimeout)
+	for {
+		select {
+		case ended := <-r.ended:
+			if ended == id {
+				return r.latest(id)
+			}
+		case <-timeout:
+			t.Fatalf("transfer %s did not end, statuses: %v", id, r.sequence(id))
+		}
+	}
+}
+
+// waitFor blocks until the transfer reports one of the given statuses
+func (r *recorder) waitFor(t *testing.T, id string, statuses ...TransferStatus) TransferStatus {
+	t.Helper()
+
+	var status TransferStatus
+	nettest.WaitFor(t, waitTimeout, func() bool {
+		status = r.last(id)
+		for _, want := range statuses {
+			if status == want {
+				return true
+			}
+		}
+		return false
+	}, "transfer %s did not reach %v, statuses: %v", id, statuses, r.sequence(id))
+
+	return status
+}
+
+// testNode is a mesh node with a transfer manager attached
+type testNode struct {
+	*nettest.Node
+	transfers   *Manager
+	recorder    *recorder
+	downloadDir string
+}
+
+// newTestNodes creates n connected nodes whose transfer managers accept every offer
+func newTestNodes(t *testing.T, n int) (*nettest.Mesh, []*testNode) {
+	t.Helper()
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	mesh := nettest.New(t, n)
+	nodes := make([]*testNode, n)
+	for i, node := range mesh.Nodes {
+		tn := &testNode{
+			Node:        node,
+			transfers:   New(node.Network, node.Identity, config.Default().Transfer),
+			recorder:    newRecorder(),
+			downloadDir: filepath.Join(home, node.Identity.GetNickname()),
+		}
+		if err := tn.transfers.SetDownloadDir(tn.downloadDir); err != nil {
+			t.Fatalf("failed to set download dir: %v", err)
+		}
+		tn.transfers.SetTransferUpdateHandler(tn.recorder.update)
+		tn.onOffer(func(*Transfer) bool { return true })
+		nodes[i] = tn
+	}
+
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			mesh.Connect(t, i, j)
+		}
+	}
+
+	return mesh, nodes
+}
+
+// onOffer installs an offer decision that also records the pending transfer
+func (n *testNode) onOffer(decide func(*Transfer) bool) {
+	n.transfers.SetTransferOfferHandler(func(transfer *Transfer) bool {
+		n.recorder.update(transfer)
+		return decide(transfer)
+	})
+}
+
+// send offers a file to another node and records the pending outgoing transfer
+func (n *testNode) send(t *testing.T, to *testNode, path string) *Transfer {
+	t.Helper()
+
+	transfer, err := n.transfers.SendFile(to.ID(), path)
+	if err != nil {
+		t.Fatalf("SendFile failed: %v", err)
+	}
+
+	// Put the initial status first even if the accept won the race
+	n.recorder.mutex.Lock()
+	seq := n.recorder.statuses[transfer.ID]
+	if len(seq) == 0 || seq[0] != StatusPending {
+		n.recorder.statuses[transfer.ID] = append([]TransferStatus{StatusPending}, seq...)
+	}
+	n.recorder.mutex.Unlock()
+
+	return transfer
+}
+
+// writeRandomFile creates a file of the given size filled with random bytes
+func writeRandomFile(t *testing.T, name string, size int) (string, []byte) {
+	t.Helper()
+
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("failed to generate file data: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	return path, data
+}
+
+func assertSequence(t *testing.T, who string, got []TransferStatus, want ...TransferStatus) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("%s statuses = %v, want %v", who, got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("%s statuses = %v, want %v", who, got, want)
+		}
+	}
+}
+
+func TestTransferOfferAccept(t *testing.T) {
+	_, nodes := newTestNodes(t, 2)
+	sender, receiver := nodes[0], nodes[1]
+
+	path, data := writeRandomFile(t, "report.pdf", 10*chunkSize+17)
+	transfer := sender.send(t, receiver, path)
+
+	receiver.recorder.waitFor(t, transfer.ID, StatusCompleted, StatusFailed)
+	sender.recorder.waitFor(t, transfer.ID, StatusCompleted, StatusFailed)
+
+	assertSequence(t, "receiver", receiver.recorder.sequence(transfer.ID), StatusPending, StatusActive, StatusCompleted)
+	assertSequence(t, "sender", sender.recorder.sequence(transfer.ID), StatusPending, StatusActive, StatusCompleted)
+
+	received, err := os.ReadFile(filepath.Join(receiver.downloadDir, "report.pdf"))
+	if err != nil {
+		t.Fatalf("failed to read received file: %v", err)
+	}
+	if !bytes.Equal(received, data) {
+		t.Fatalf("received file differs from the original")
+	}
+
+	// The sender keeps the receiver's signed receipt
+	nettest.WaitFor(t, waitTimeout, func() bool {
+		return sender.recorder.latest(transfer.ID).Receipt != nil
+	}, "sender never received a delivery receipt")
+
+	incoming := receiver.recorder.latest(transfer.ID)
+	if incoming.MIMEType != "application/pdf" {
+		t.Errorf("receiver MIME type = %q, want application/pdf", incoming.MIMEType)
+	}
+}
+
+func TestTransferOfferReject(t *testing.T) {
+	_, nodes := newTestNodes(t, 2)
+	sender, receiver := nodes[0], nodes[1]
+	receiver.onOffer(func(*Transfer) bool { return false })
+
+	path, _ := writeRandomFile(t, "unwanted.bin", 4*chunkSize)
+	transfer := sender.send(t, receiver, path)
+
+	sender.recorder.waitFor(t, transfer.ID, StatusCancelled)
+	receiver.recorder.waitFor(t, transfer.ID, StatusCancelled)
+
+	assertSequence(t, "receiver", receiver.recorder.sequence(transfer.ID), StatusPending, StatusCancelled)
+	assertSequence(t, "sender", sender.recorder.sequence(transfer.ID), StatusPending, StatusCancelled)
+
+	if outgoing := sender.recorder.latest(transfer.ID); outgoing.Error != "" {
+		t.Errorf("declined transfer has error %q", outgoing.Error)
+	}
+	if _, err := os.Stat(filepath.Join(receiver.downloadDir, "unwanted.bin")); !os.IsNotExist(err) {
+		t.Errorf("rejected file was written to the download directory")
+	}
+}
+
+func TestTransferCancelMidStream(t *testing.T) {
+	_, nodes := newTestNodes(t, 2)
+	sender, receiver := nodes[0], nodes[1]
+
+	path, _ := writeRandomFile(t, "big.iso", 2048*chunkSize)
+	transfer := sender.send(t, receiver, path)
+
+	// Cancel from the sending side as soon as the first bytes land
+	select {
+	case <-receiver.recorder.progress:
+	case <-time.After(waitTimeout):
+		t.Fatalf("transfer never started")
+	}
+	if err := sender.transfers.CancelTransfer(transfer.ID); err != nil {
+		t.Fatalf("CancelTransfer failed: %v", err)
+	}
+
+	sender.recorder.waitFor(t, transfer.ID, StatusCancelled, StatusCompleted, StatusFailed)
+	receiver.recorder.waitFor(t, transfer.ID, StatusCancelled, StatusCompleted, StatusFailed)
+
+	assertSequence(t, "sender", sender.recorder.sequence(transfer.ID), StatusPending, StatusActive, StatusCancelled)
+	assertSequence(t, "receiver", receiver.recorder.sequence(transfer.ID), StatusPending, StatusActive, StatusCancelled)
+
+	// Give stray chunks time to arrive, they must not revive the transfer
+	time.Sleep(200 * time.Millisecond)
+	if status := receiver.recorder.last(transfer.ID); status != StatusCancelled {
+		t.Fatalf("receiver status changed to %s after cancel", status)
+	}
+	if outgoing := sender.recorder.latest(transfer.ID); outgoing.Transferred >= outgoing.Size {
+		t.Fatalf("sender kept sending after cancel: %d of %d bytes", outgoing.Transferred, outgoing.Size)
+	}
+}
+
+func TestTransferDisconnectMidTransfer(t *testing.T) {
+	mesh, nodes := newTestNodes(t, 2)
+	sender, receiver := nodes[0], nodes[1]
+
+	path, _ := writeRandomFile(t, "video.mp4", 2048*chunkSize)
+	transfer := sender.send(t, receiver, path)
+
+	select {
+	case <-receiver.recorder.progress:
+	case <-time.After(waitTimeout):
+		t.Fatalf("transfer never started")
+	}
+	mesh.Unlink(t, 0, 1)
+
+	senderStatus := sender.recorder.waitFor(t, transfer.ID, StatusCancelled, StatusFailed, StatusCompleted)
+	receiverStatus := receiver.recorder.waitFor(t, transfer.ID, StatusCancelled, StatusFailed, StatusCompleted)
+
+	if senderStatus == StatusCompleted || receiverStatus == StatusCompleted {
+		t.Fatalf("transfer completed despite disconnect: sender %s, receiver %s", senderStatus, receiverStatus)
+	}
+	if receiverStatus != StatusCancelled {
+		t.Errorf("receiver status = %s, want %s", receiverStatus, StatusCancelled)
+	}
+}
+
+func TestTransferStopMidTransfer(t *testing.T) {
+	_, nodes := newTestNodes(t, 2)
+	sender, receiver := nodes[0], nodes[1]
+
+	path, _ := writeRandomFile(t, "backup.img", 2048*chunkSize)
+	transfer := sender.send(t, receiver, path)
+
+	select {
+	case <-receiver.recorder.progress:
+	case <-time.After(waitTimeout):
+		t.Fatalf("transfer never started")
+	}
+
+	// Shutting down the sender cancels the transfer and tells the receiver why
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+	sender.transfers.Stop(ctx)
+
+	if status := sender.recorder.last(transfer.ID); status != StatusCancelled {
+		t.Fatalf("sender status = %s, want %s", status, StatusCancelled)
+	}
+	receiver.recorder.waitFor(t, transfer.ID, StatusFailed, StatusCancelled, StatusCompleted)
+	if incoming := receiver.recorder.latest(transfer.ID); incoming.Error != "cancelled by peer: shutdown" {
+		t.Errorf("receiver error = %q", incoming.Error)
+	}
+
+	// The interrupted transfer is kept in the history
+	found := false
+	for _, entry := range sender.transfers.GetHistory() {
+		if entry.ID == transfer.ID && entry.Status == StatusCancelled {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("cancelled transfer missing from the sender's history")
+	}
+}
+
+func TestTransferFileSizes(t *testing.T) {
+	sizes := []struct {
+		name string
+		size int
+	}{
+		{"empty", 0},
+		{"one_byte", 1},
+		{"exact_chunk", chunkSize},
+		{"chunk_plus_one", chunkSize + 1},
+		{"large", 3*1024*1024 + 517},
+	}
+
+	for _, tc := range sizes {
+		t.Run(tc.name, func(t *testing.T) {
+			_, nodes := newTestNodes(t, 2)
+			sender, receiver := nodes[0], nodes[1]
+
+			path, data := writeRandomFile(t, tc.name+".dat", tc.size)
+			transfer := sender.send(t, receiver, path)
+
+			if status := receiver.recorder.waitFor(t, transfer.ID, StatusCompleted, StatusFailed); status != StatusCompleted {
+				t.Fatalf("receiver status = %s: %s", status, receiver.recorder.latest(transfer.ID).Error)
+			}
+			sender.recorder.waitFor(t, transfer.ID, StatusCompleted)
+
+			received, err := os.ReadFile(filepath.Join(receiver.downloadDir, tc.name+".dat"))
+			if err != nil {
+				t.Fatalf("failed to read received file: %v", err)
+			}
+			if !bytes.Equal(received, data) {
+				t.Fatalf("received %d bytes differing from the %d byte original", len(received), len(data))
+			}
+		})
+	}
+}
+
+func TestTransferCorruptedChunks(t *testing.T) {
+	_, nodes := newTestNodes(t, 2)
+	sender, receiver := nodes[0], nodes[1]
+
+	path, _ := writeRandomFile(t, "archive.tar", 8*chunkSize)
+
+	// Flip a byte of one chunk on its way to the receiver, so the file no longer
+	// matches the checksum the receiver was promised. The manager's own transfer
+	// subscription is the last one it registered.
+	receiver.transfers.unsubscribes[len(receiver.transfers.unsubscribes)-1]()
+	unsubscribe := receiver.Network.SubscribeMessages(network.TransferProtocol, func(event network.MessageEvent) {
+		var msg TransferMessage
+		if err := json.Unmarshal(event.Data, &msg); err == nil && msg.Type == MsgTypeData && msg.Data["chunk_index"] == float64(3) {
+			chunk, _ := base64.StdEncoding.DecodeString(msg.Data["data"].(string))
+			chunk[5] ^= 0xff
+			msg.Data["data"] = base64.StdEncoding.EncodeToString(chunk)
+			event.Data, _ = json.Marshal(msg)
+		}
+		receiver.transfers.handleMessage(event)
+	})
+	defer unsubscribe()
+
+	transfer := sender.send(t, receiver, path)
+
+	incoming := receiver.recorder.waitEnded(t, transfer.ID)
+	assertSequence(t, "receiver", receiver.recorder.sequence(transfer.ID), StatusPending, StatusActive, StatusFailed)
+	if incoming.Error != "checksum verification failed" {
+		t.Errorf("receiver error = %q", incoming.Error)
+	}
+	if incoming.Receipt != nil {
+		t.Errorf("receiver signed a receipt for a corrupted file")
+	}
+
+	// The sender may finish sending before it learns that delivery failed
+	outgoing := sender.recorder.waitEnded(t, transfer.ID)
+	if outgoing.Status == StatusCompleted {
+		outgoing = sender.recorder.waitEnded(t, transfer.ID)
+	}
+	if outgoing.Status != StatusFailed || outgoing.Error != "cancelled by peer: checksum_mismatch" {
+		t.Errorf("sender status = %s, error = %q", outgoing.Status, outgoing.Error)
+	}
+}
+
+func TestTransferDuplicateAndOutOfRangeChunks(t *testing.T) {
+	_, nodes := newTestNodes(t, 2)
+	sender, receiver := nodes[0], nodes[1]
+
+	file, err := os.Create(filepath.Join(t.TempDir(), "incoming.bin"))
+	if err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+	transfer := &Transfer{
+		ID:        "chunks",
+		Size:      3 * chunkSize,
+		Status:    StatusActive,
+		Direction: DirectionReceive,
+		PeerID:    sender.ID(),
+		FilePath:  file.Name(),
+		file:      file,
+		chunks:    newChunkSet(3 * chunkSize),
+	}
+	receiver.transfers.mutex.Lock()
+	receiver.transfers.transfers[transfer.ID] = transfer
+	receiver.transfers.mutex.Unlock()
+
+	chunk := func(index float64, size int) TransferMessage {
+		return TransferMessage{Type: MsgTypeData, Data: map[string]interface{}{
+			"transfer_id": transfer.ID,
+			"chunk_index": index,
+			"data":        base64.StdEncoding.EncodeToString(make([]byte, size)),
+			"is_last":     false,
+		}}
+	}
+
+	// A repeated chunk is counted once and does not complete the transfer early
+	receiver.transfers.handleTransferData(sender.ID(), chunk(0, chunkSize))
+	receiver.transfers.handleTransferData(sender.ID(), chunk(0, chunkSize))
+	receiver.transfers.handleTransferData(sender.ID(), chunk(0, chunkSize))
+	if got := receiver.transfers.snapshot(transfer); got.Transferred != chunkSize || got.Status != StatusActive {
+		t.Fatalf("after duplicates: transferred %d, status %s", got.Transferred, got.Status)
+	}
+
+	// Malformed messages are dropped without failing the transfer
+	receiver.transfers.handleTransferData(sender.ID(), TransferMessage{Type: MsgTypeData, Data: map[string]interface{}{"transfer_id": transfer.ID}})
+	if got := receiver.transfers.snapshot(transfer); got.Status != StatusActive {
+		t.Fatalf("malformed message changed status to %s", got.Status)
+	}
+
+	// A chunk past the offered size fails the transfer without growing the file
+	receiver.transfers.handleTransferData(sender.ID(), chunk(1<<30, chunkSize))
+	if got := receiver.transfers.snapshot(transfer); got.Status != StatusFailed {
+		t.Fatalf("out of range chunk left status %s", got.Status)
+	}
+	info, err := os.Stat(transfer.FilePath)
+	if err != nil {
+		t.Fatalf("failed to stat file: %v", err)
+	}
+	if info.Size() > transfer.Size {
+		t.Fatalf("file grew to %d bytes", info.Size())
+	}
+}
+
+func TestTransferStaleAndReplayedOffers(t *testing.T) {
+	_, nodes := newTestNodes(t, 2)
+	sender, receiver := nodes[0], nodes[1]
+
+	offer := func(id string, signed time.Time) *Offer {
+		return &Offer{TransferID: id, SenderID: sender.ID().String(), Timestamp: signed.Unix()}
+	}
+
+	fresh := offer("fresh", time.Now())
+	if err := receiver.transfers.checkOfferFresh(sender.ID(), fresh); err != nil {
+		t.Fatalf("fresh offer refused: %v", err)
+	}
+	if err := receiver.transfers.checkOfferFresh(sender.ID(), fresh); err == nil {
+		t.Errorf("replayed offer accepted")
+	}
+
+	if err := receiver.transfers.checkOfferFresh(sender.ID(), offer("old", time.Now().Add(-offerMaxAge-time.Minute))); err == nil {
+		t.Errorf("stale offer accepted")
+	}
+	if err := receiver.transfers.checkOfferFresh(sender.ID(), offer("future", time.Now().Add(offerMaxAge+time.Minute))); err == nil {
+		t.Errorf("offer from the future accepted")
+	}
+}
+
+func TestTransferDoubleAccept(t *testing.T) {
+	_, nodes := newTestNodes(t, 2)
+	sender, receiver := nodes[0], nodes[1]
+
+	path, _ := writeRandomFile(t, "notes.txt", 2*chunkSize)
+	transfer := sender.send(t, receiver, path)
+	receiver.recorder.waitFor(t, transfer.ID, StatusCompleted, StatusFailed)
+
+	// Answering the offer again is refused and does not charge the quota twice
+	if err := receiver.transfers.AcceptTransfer(transfer.ID); err == nil {
+		t.Errorf("second accept succeeded")
+	}
+	if err := receiver.transfers.RejectTransfer(transfer.ID); err == nil {
+		t.Errorf("reject after accept succeeded")
+	}
+
+	receiver.transfers.quotas.mutex.Lock()
+	charged := receiver.transfers.quotas.peers[sender.ID()].bytesToday
+	receiver.transfers.quotas.mutex.Unlock()
+	if charged != transfer.Size {
+		t.Errorf("quota charged %d bytes, want %d", charged, transfer.Size)
+	}
+	if status := receiver.recorder.last(transfer.ID); status != StatusCompleted {
+		t.Errorf("receiver status = %s after second accept", status)
+	}
+}
+
+func TestTransferShareRedeemedOnCompletion(t *testing.T) {
+	_, nodes := newTestNodes(t, 2)
+	sharer, receiver := nodes[0], nodes[1]
+
+	path, _ := writeRandomFile(t, "slides.odp", 3*chunkSize)
+	share, link, err := sharer.transfers.CreateShare(path, 0)
+	if err != nil {
+		t.Fatalf("CreateShare failed: %v", err)
+	}
+
+	shareState := func() Share {
+		for _, s := range sharer.transfers.GetShares() {
+			if s.Token == share.Token {
+				return s
+			}
+		}
+		t.Fatalf("share %s not listed", share.Token)
+		return Share{}
+	}
+
+	// A request the receiver did not make is offered like any file, declining it keeps the token usable
+	receiver.onOffer(func(*Transfer) bool { return false })
+	sharer.transfers.handleShareRequest(receiver.ID(), TransferMessage{
+		Type: MsgTypeShareRequest,
+		Data: map[string]interface{}{"token": share.Token},
+	})
+	nettest.WaitFor(t, waitTimeout, func() bool {
+		return shareState().Active()
+	}, "declined share was not released")
+	if state := shareState(); state.Redeemed {
+		t.Fatalf("declined share was marked redeemed")
+	}
+
+	// Redeeming the link for real uses up the token once the file arrived
+	if err := receiver.transfers.RedeemShareLink(link.String()); err != nil {
+		t.Fatalf("RedeemShareLink failed: %v", err)
+	}
+	nettest.WaitFor(t, waitTimeout, func() bool {
+		return shareState().Redeemed
+	}, "share was not redeemed after the transfer")
+	if state := shareState(); state.RedeemedBy != receiver.ID() || state.Active() {
+		t.Errorf("redeemed share = %+v", state)
+	}
+}
@@ -0,0 +1,118 @@
+package transfer
+
+import (
+	"shario/internal/config"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// RejectReason explains why an offer was rejected
+type RejectReason string
+
+// Reject reason codes sent with MsgTypeReject
+const (
+	ReasonDeclined         RejectReason = "declined"
+	ReasonInvalidSignature RejectReason = "invalid_signature"
+	ReasonTooManyPending   RejectReason = "too_many_pending"
+	ReasonRateLimited      RejectReason = "rate_limited"
+	ReasonDailyQuota       RejectReason = "daily_quota_exceeded"
+	ReasonStaleOffer       RejectReason = "stale_offer"
+)
+
+// peerQuota tracks the receive activity of a single peer
+type peerQuota struct {
+	offers     []time.Time // offers received within the last minute
+	dayStart   time.Time
+	bytesToday int64
+}
+
+// quotaTracker enforces the per-peer receive limits
+type quotaTracker struct {
+	limits config.TransferConfig
+	peers  map[peer.ID]*peerQuota
+	mutex  sync.Mutex
+}
+
+// newQuotaTracker creates a quota tracker with the given limits
+func newQuotaTracker(limits config.TransferConfig) *quotaTracker {
+	return &quotaTracker{
+		limits: limits,
+		peers:  make(map[peer.ID]*peerQuota),
+	}
+}
+
+// peerLocked returns the quota record for a peer, resetting the daily counter when a day has passed
+func (q *quotaTracker) peerLocked(peerID peer.ID, now time.Time) *peerQuota {
+	quota, exists := q.peers[peerID]
+	if !exists {
+		quota = &peerQuota{dayStart: now}
+		q.peers[peerID] = quota
+	}
+
+	if now.Sub(quota.dayStart) >= 24*time.Hour {
+		quota.dayStart = now
+		quota.bytesToday = 0
+	}
+
+	return quota
+}
+
+// checkOffer records an offer and returns a reject reason if it exceeds a limit
+func (q *quotaTracker) checkOffer(peerID peer.ID, size int64, pending int) RejectReason {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	now := time.Now()
+	quota := q.peerLocked(peerID, now)
+
+	// Drop offers that fell out of the one-minute window
+	recent := quota.offers[:0]
+	for _, t := range quota.offers {
+		if now.Sub(t) < time.Minute {
+			recent = append(recent, t)
+		}
+	}
+	quota.offers = append(recent, now)
+
+	if q.limits.MaxOffersPerMinute > 0 && len(quota.offers) > q.limits.MaxOffersPerMinute {
+		return ReasonRateLimited
+	}
+
+	if q.limits.MaxPendingOffers > 0 && pending >= q.limits.MaxPendingOffers {
+		return ReasonTooManyPending
+	}
+
+	if q.limits.MaxBytesPerDay > 0 && quota.bytesToday+size > q.limits.MaxBytesPerDay {
+		return ReasonDailyQuota
+	}
+
+	return ""
+}
+
+// reserve counts an accepted transfer's size against a peer's daily total up front, so
+// concurrent offers cannot each pass the quota. It reports false if the size no longer fits.
+func (q *quotaTracker) reserve(peerID peer.ID, size int64) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	quota := q.peerLocked(peerID, time.Now())
+	if q.limits.MaxBytesPerDay > 0 && quota.bytesToday+size > q.limits.MaxBytesPerDay {
+		return false
+	}
+	quota.bytesToday += size
+	return true
+}
+
+// release returns the unreceived part of a reservation when a transfer ends early
+func (q *quotaTracker) release(peerID peer.ID, n int64) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	quota := q.peerLocked(peerID, time.Now())
+	quota.bytesToday -= n
+	if quota.bytesToday < 0 {
+		quota.bytesToday = 0
+	}
+}
@@ -0,0 +1,337 @@
+package transfer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// ShareLinkPrefix identifies an encoded share link
+const ShareLinkPrefix = "shario-share:"
+
+// Share is a file published under a one-time token
+type Share struct {
+	Token      string     `json:"token"`
+	Filename   string     `json:"filename"`
+	FilePath   string     `json:"file_path"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	Redeemed   bool       `json:"redeemed"`
+	RedeemedBy peer.ID    `json:"redeemed_by,omitempty"`
+	RedeemedAt *time.Time `json:"redeemed_at,omitempty"`
+	Revoked    bool       `json:"revoked"`
+
+	sending bool // the file is being offered or sent under this token
+}
+
+// Active reports whether the share can still be redeemed
+func (s Share) Active() bool {
+	if s.Redeemed || s.Revoked || s.sending {
+		return false
+	}
+	return s.ExpiresAt == nil || time.Now().Before(*s.ExpiresAt)
+}
+
+// Sending reports whether the shared file is on its way to a peer that presented the token
+func (s Share) Sending() bool {
+	return s.sending
+}
+
+// ShareLink is the decoded content of a share link
+type ShareLink struct {
+	PeerID    string   `json:"peer"`
+	Addrs     []string `json:"addrs"`
+	Token     string   `json:"token"`
+	Filename  string   `json:"filename"`
+	ExpiresAt int64    `json:"expires_at,omitempty"`
+}
+
+// String encodes the share link for copying and pasting
+func (l *ShareLink) String() string {
+	data, _ := json.Marshal(l)
+	return ShareLinkPrefix + base64.RawURLEncoding.EncodeToString(data)
+}
+
+// AddrInfo returns the peer address info encoded in the link
+func (l *ShareLink) AddrInfo() (*peer.AddrInfo, error) {
+	peerID, err := peer.Decode(l.PeerID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid peer ID in share link: %w", err)
+	}
+
+	info := &peer.AddrInfo{ID: peerID}
+	for _, addrStr := range l.Addrs {
+		addr, err := multiaddr.NewMultiaddr(addrStr)
+		if err != nil {
+			continue
+		}
+		info.Addrs = append(info.Addrs, addr)
+	}
+
+	return info, nil
+}
+
+// ParseShareLink decodes a share link
+func ParseShareLink(link string) (*ShareLink, error) {
+	link = strings.TrimSpace(link)
+	if !strings.HasPrefix(link, ShareLinkPrefix) {
+		return nil, fmt.Errorf("not a share link")
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(link, ShareLinkPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode share link: %w", err)
+	}
+
+	var shareLink ShareLink
+	if err := json.Unmarshal(data, &shareLink); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal share link: %w", err)
+	}
+
+	if shareLink.Token == "" || shareLink.PeerID == "" {
+		return nil, fmt.Errorf("incomplete share link")
+	}
+
+	return &shareLink, nil
+}
+
+// CreateShare publishes a file under a new one-time token, ttl of zero means no expiry
+func (m *Manager) CreateShare(filePath string, ttl time.Duration) (*Share, *ShareLink, error) {
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	if fileInfo.IsDir() {
+		return nil, nil, fmt.Errorf("cannot share a directory")
+	}
+
+	tokenBytes := make([]byte, 16)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate share token: %w", err)
+	}
+
+	share := &Share{
+		Token:     hex.EncodeToString(tokenBytes),
+		Filename:  filepath.Base(filePath),
+		FilePath:  filePath,
+		CreatedAt: time.Now(),
+	}
+	if ttl > 0 {
+		expiresAt := share.CreatedAt.Add(ttl)
+		share.ExpiresAt = &expiresAt
+	}
+
+	host := m.network.GetHost()
+	link := &ShareLink{
+		PeerID:   host.ID().String(),
+		Token:    share.Token,
+		Filename: share.Filename,
+	}
+	for _, addr := range host.Addrs() {
+		link.Addrs = append(link.Addrs, addr.String())
+	}
+	if share.ExpiresAt != nil {
+		link.ExpiresAt = share.ExpiresAt.Unix()
+	}
+
+	m.mutex.Lock()
+	m.shares[share.Token] = share
+	m.mutex.Unlock()
+
+	log.Printf("📁 CreateShare: Published %s under token %s", share.Filename, share.Token)
+	return share, link, nil
+}
+
+// GetShares returns copies of all shares created in this session, including used ones
+func (m *Manager) GetShares() []Share {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	shares := make([]Share, 0, len(m.shares))
+	for _, share := range m.shares {
+		shares = append(shares, *share)
+	}
+
+	return shares
+}
+
+// RevokeShare invalidates a share token before it is redeemed
+func (m *Manager) RevokeShare(token string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	share, exists := m.shares[token]
+	if !exists {
+		return fmt.Errorf("share not found: %s", token)
+	}
+
+	share.Revoked = true
+	return nil
+}
+
+// RedeemShareLink connects to the sharing peer and requests the linked file
+func (m *Manager) RedeemShareLink(link string) error {
+	shareLink, err := ParseShareLink(link)
+	if err != nil {
+		return err
+	}
+
+	if shareLink.ExpiresAt != 0 && time.Now().Unix() > shareLink.ExpiresAt {
+		return fmt.Errorf("share link expired")
+	}
+
+	info, err := shareLink.AddrInfo()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := m.network.Connect(ctx, *info); err != nil {
+		return fmt.Errorf("failed to connect to sharing peer: %w", err)
+	}
+
+	m.mutex.Lock()
+	m.redeeming[shareLink.Token] = info.ID
+	m.mutex.Unlock()
+
+	msg := TransferMessage{
+		Type: MsgTypeShareRequest,
+		Data: map[string]interface{}{
+			"token": shareLink.Token,
+		},
+	}
+
+	log.Printf("📁 RedeemShareLink: Requesting %s from peer %s", shareLink.Filename, info.ID.String())
+	if err := m.sendMessage(info.ID, msg); err != nil {
+		m.mutex.Lock()
+		delete(m.redeeming, shareLink.Token)
+		m.mutex.Unlock()
+		return fmt.Errorf("failed to send share request: %w", err)
+	}
+
+	return nil
+}
+
+// SetShareDeniedHandler sets the callback for share requests refused by the sharing peer
+func (m *Manager) SetShareDeniedHandler(handler func(token, reason string)) {
+	m.onShareDenied = handler
+}
+
+// handleShareRequest redeems a share token and offers the shared file to the requester
+func (m *Manager) handleShareRequest(peerID peer.ID, msg TransferMessage) {
+	token, _ := msg.Data["token"].(string)
+
+	m.mutex.Lock()
+	share, exists := m.shares[token]
+	reason := ""
+	switch {
+	case !exists:
+		reason = "unknown_token"
+	case !share.Active():
+		reason = "token_expired"
+	default:
+		// Hold the token while sending so it can only be pulled once, it is redeemed when the transfer completes
+		share.sending = true
+	}
+	m.mutex.Unlock()
+
+	if reason != "" {
+		log.Printf("📁 handleShareRequest: Denying share request from %s: %s", peerID.String(), reason)
+		m.sendMessage(peerID, TransferMessage{
+			Type: MsgTypeShareDenied,
+			Data: map[string]interface{}{
+				"token":  token,
+				"reason": reason,
+			},
+		})
+		return
+	}
+
+	log.Printf("📁 handleShareRequest: Offering share %s to %s", token, peerID.String())
+	if _, err := m.offerFile(peerID, share.FilePath, token); err != nil {
+		log.Printf("📁 handleShareRequest: Failed to offer shared file: %v", err)
+
+		// Nothing was sent, so the token stays usable
+		m.mutex.Lock()
+		share.sending = false
+		m.mutex.Unlock()
+	}
+}
+
+// settleShare redeems a share token when its transfer completes and frees it when the transfer ends any other way
+func (m *Manager) settleShare(transfer *Transfer) {
+	if transfer.ShareToken == "" || transfer.Direction != DirectionSend {
+		return
+	}
+	switch transfer.Status {
+	case StatusCompleted, StatusFailed, StatusCancelled:
+	default:
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	share, exists := m.shares[transfer.ShareToken]
+	if !exists || !share.sending {
+		return
+	}
+	share.sending = false
+
+	if transfer.Status == StatusCompleted {
+		log.Printf("📁 settleShare: Token %s redeemed by %s", share.Token, transfer.PeerID.String())
+		now := time.Now()
+		share.Redeemed = true
+		share.RedeemedBy = transfer.PeerID
+		share.RedeemedAt = &now
+	}
+}
+
+// handleShareDenied handles a refused share request
+func (m *Manager) handleShareDenied(peerID peer.ID, msg TransferMessage) {
+	token, _ := msg.Data["token"].(string)
+	reason, _ := msg.Data["reason"].(string)
+
+	m.mutex.Lock()
+	_, requested := m.redeeming[token]
+	delete(m.redeeming, token)
+	m.mutex.Unlock()
+
+	if !requested {
+		return
+	}
+
+	log.Printf("📁 handleShareDenied: Peer %s refused share %s: %s", peerID.String(), token, reason)
+	if m.onShareDenied != nil {
+		m.onShareDenied(token, reason)
+	}
+}
+
+// claimRedemption reports whether an offer answers one of our share requests
+func (m *Manager) claimRedemption(peerID peer.ID, token string) bool {
+	if token == "" {
+		return false
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if requestedFrom, exists := m.redeeming[token]; exists && requestedFrom == peerID {
+		delete(m.redeeming, token)
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,270 @@
+package transfer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// offerMaxAge is how far an offer's timestamp may be from our clock before the offer is refused
+const offerMaxAge = 5 * time.Minute
+
+// Offer is the signed description of a file a peer is about to send
+type Offer struct {
+	TransferID string `json:"transfer_id"`
+	Filename   string `json:"filename"`
+	Size       int64  `json:"size"`
+	Checksum   string `json:"checksum"`
+	SenderID   string `json:"sender_id"`
+	Timestamp  int64  `json:"timestamp"`
+	ShareToken string `json:"share_token,omitempty"`
+	Mode       uint32 `json:"mode,omitempty"`     // permission bits
+	ModTime    int64  `json:"mod_time,omitempty"` // unix seconds
+	MIMEType   string `json:"mime_type,omitempty"`
+	Signature  []byte `json:"signature,omitempty"`
+}
+
+// Receipt is the receiver's signed acknowledgement of a verified delivery
+type Receipt struct {
+	TransferID string `json:"transfer_id"`
+	Filename   string `json:"filename"`
+	Size       int64  `json:"size"`
+	Checksum   string `json:"checksum"`
+	SenderID   string `json:"sender_id"`
+	ReceiverID string `json:"receiver_id"`
+	ReceivedAt int64  `json:"received_at"`
+	Signature  []byte `json:"signature,omitempty"`
+}
+
+// signingBytes returns the canonical bytes covered by the offer signature
+func (o *Offer) signingBytes() ([]byte, error) {
+	unsigned := *o
+	unsigned.Signature = nil
+	return json.Marshal(unsigned)
+}
+
+// signingBytes returns the canonical bytes covered by the receipt signature
+func (r *Receipt) signingBytes() ([]byte, error) {
+	unsigned := *r
+	unsigned.Signature = nil
+	return json.Marshal(unsigned)
+}
+
+// signOffer builds and signs the offer for an outgoing transfer
+func (m *Manager) signOffer(transfer *Transfer) (*Offer, error) {
+	offer := &Offer{
+		TransferID: transfer.ID,
+		Filename:   transfer.Filename,
+		Size:       transfer.Size,
+		Checksum:   transfer.Checksum,
+		SenderID:   m.identity.GetPeerID().String(),
+		Timestamp:  time.Now().Unix(),
+		ShareToken: transfer.ShareToken,
+		Mode:       uint32(transfer.Mode.Perm()),
+		MIMEType:   transfer.MIMEType,
+	}
+	if !transfer.ModTime.IsZero() {
+		offer.ModTime = transfer.ModTime.Unix()
+	}
+
+	data, err := offer.signingBytes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode offer: %w", err)
+	}
+
+	signature, err := m.identity.SignData(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign offer: %w", err)
+	}
+
+	offer.Signature = signature
+	return offer, nil
+}
+
+// signReceipt builds and signs the receipt for a verified incoming transfer
+func (m *Manager) signReceipt(transfer *Transfer) (*Receipt, error) {
+	receipt := &Receipt{
+		TransferID: transfer.ID,
+		Filename:   transfer.Filename,
+		Size:       transfer.Size,
+		Checksum:   transfer.Checksum,
+		SenderID:   transfer.PeerID.String(),
+		ReceiverID: m.identity.GetPeerID().String(),
+		ReceivedAt: time.Now().Unix(),
+	}
+
+	data, err := receipt.signingBytes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode receipt: %w", err)
+	}
+
+	signature, err := m.identity.SignData(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign receipt: %w", err)
+	}
+
+	receipt.Signature = signature
+	return receipt, nil
+}
+
+// verifyOffer checks that the offer was signed by the peer that sent it
+func (m *Manager) verifyOffer(peerID peer.ID, offer *Offer) error {
+	if offer.SenderID != peerID.String() {
+		return fmt.Errorf("offer sender %s does not match connection peer %s", offer.SenderID, peerID)
+	}
+
+	data, err := offer.signingBytes()
+	if err != nil {
+		return fmt.Errorf("failed to encode offer: %w", err)
+	}
+
+	return m.verifyPeerSignature(peerID, data, offer.Signature)
+}
+
+// checkOfferFresh refuses offers signed outside the freshness window and replays of offers already seen
+func (m *Manager) checkOfferFresh(peerID peer.ID, offer *Offer) error {
+	now := time.Now()
+	signed := time.Unix(offer.Timestamp, 0)
+	if signed.Before(now.Add(-offerMaxAge)) || signed.After(now.Add(offerMaxAge)) {
+		return fmt.Errorf("offer signed at %s is outside the %s window", signed.Format(time.RFC3339), offerMaxAge)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	// An offer can only be replayed while its timestamp is fresh, so it is remembered until then
+	for key, expires := range m.seenOffers {
+		if now.After(expires) {
+			delete(m.seenOffers, key)
+		}
+	}
+
+	key := peerID.String() + "/" + offer.TransferID
+	if _, seen := m.seenOffers[key]; seen {
+		return fmt.Errorf("offer %s was already received", offer.TransferID)
+	}
+	m.seenOffers[key] = signed.Add(offerMaxAge)
+
+	return nil
+}
+
+// verifyReceipt checks that the receipt was signed by the receiving peer and matches the transfer
+func (m *Manager) verifyReceipt(peerID peer.ID, transfer *Transfer, receipt *Receipt) error {
+	if receipt.ReceiverID != peerID.String() {
+		return fmt.Errorf("receipt signer %s does not match connection peer %s", receipt.ReceiverID, peerID)
+	}
+
+	if receipt.SenderID != m.identity.GetPeerID().String() {
+		return fmt.Errorf("receipt is not addressed to us")
+	}
+
+	if receipt.Checksum != transfer.Checksum || receipt.Size != transfer.Size {
+		return fmt.Errorf("receipt does not match transfer %s", transfer.ID)
+	}
+
+	data, err := receipt.signingBytes()
+	if err != nil {
+		return fmt.Errorf("failed to encode receipt: %w", err)
+	}
+
+	return m.verifyPeerSignature(peerID, data, receipt.Signature)
+}
+
+// verifyPeerSignature verifies a signature against the public key of a peer
+func (m *Manager) verifyPeerSignature(peerID peer.ID, data, signature []byte) error {
+	if len(signature) == 0 {
+		return fmt.Errorf("missing signature")
+	}
+
+	publicKey := m.network.GetHost().Peerstore().PubKey(peerID)
+	if publicKey == nil {
+		return fmt.Errorf("no public key known for peer %s", peerID)
+	}
+
+	if err := m.identity.VerifyIdentity(peerID, publicKey); err != nil {
+		return err
+	}
+
+	valid, err := m.identity.VerifySignature(data, signature, publicKey)
+	if err != nil {
+		return fmt.Errorf("failed to verify signature: %w", err)
+	}
+	if !valid {
+		return fmt.Errorf("invalid signature")
+	}
+
+	return nil
+}
+
+// parseOffer extracts an offer from a transfer protocol message
+func parseOffer(data map[string]interface{}) (*Offer, error) {
+	transferID, _ := data["transfer_id"].(string)
+	filename, _ := data["filename"].(string)
+	size, _ := data["size"].(float64)
+	checksum, _ := data["checksum"].(string)
+	senderID, _ := data["sender_id"].(string)
+	timestamp, _ := data["timestamp"].(float64)
+	shareToken, _ := data["share_token"].(string)
+	mode, _ := data["mode"].(float64)
+	modTime, _ := data["mod_time"].(float64)
+	mimeType, _ := data["mime_type"].(string)
+	encodedSignature, _ := data["signature"].(string)
+
+	if transferID == "" || filename == "" || checksum == "" {
+		return nil, fmt.Errorf("incomplete offer")
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode offer signature: %w", err)
+	}
+
+	return &Offer{
+		TransferID: transferID,
+		Filename:   filename,
+		Size:       int64(size),
+		Checksum:   checksum,
+		SenderID:   senderID,
+		Timestamp:  int64(timestamp),
+		ShareToken: shareToken,
+		Mode:       uint32(mode),
+		ModTime:    int64(modTime),
+		MIMEType:   mimeType,
+		Signature:  signature,
+	}, nil
+}
+
+// parseReceipt extracts a receipt from a transfer protocol message
+func parseReceipt(data map[string]interface{}) (*Receipt, error) {
+	transferID, _ := data["transfer_id"].(string)
+	filename, _ := data["filename"].(string)
+	size, _ := data["size"].(float64)
+	checksum, _ := data["checksum"].(string)
+	senderID, _ := data["sender_id"].(string)
+	receiverID, _ := data["receiver_id"].(string)
+	receivedAt, _ := data["received_at"].(float64)
+	encodedSignature, _ := data["signature"].(string)
+
+	if transferID == "" {
+		return nil, fmt.Errorf("incomplete receipt")
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode receipt signature: %w", err)
+	}
+
+	return &Receipt{
+		TransferID: transferID,
+		Filename:   filename,
+		Size:       int64(size),
+		Checksum:   checksum,
+		SenderID:   senderID,
+		ReceiverID: receiverID,
+		ReceivedAt: int64(receivedAt),
+		Signature:  signature,
+	}, nil
+}
@@ -3,6 +3,7 @@ package ui
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"image/color"
 	"os"
@@ -10,6 +11,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"shario/internal/chat"
+	"shario/internal/config"
 	"shario/internal/identity"
 	"shario/internal/network"
 	"shario/internal/transfer"
@@ -25,12 +27,14 @@ import (
 	"fyne.io/fyne/v2/widget"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/multiformats/go-multiaddr"
+	"github.com/skip2/go-qrcode"
 )
 
 // Manager handles the user interface
 type Manager struct {
 	app      fyne.App
 	window   fyne.Window
+	config   *config.Config
 	identity *identity.Manager
 	network  *network.Manager
 	transfer *transfer.Manager
@@ -43,6 +47,11 @@ type Manager struct {
 	messagesList  *widget.List
 	messageEntry  *widget.Entry
 	statusLabel   *widget.Label
+	statusText    *canvas.Text
+	peersText     *canvas.Text
+	transfersText *canvas.Text
+	reachText     *canvas.Text
+	trafficText   *canvas.Text
 	nicknameEntry *widget.Entry
 
 	// Data bindings
@@ -91,9 +100,10 @@ func createStatusLabel(text string, status string) *canvas.Text {
 }
 
 // New creates a new UI manager
-func New(fyneApp fyne.App, identityMgr *identity.Manager, networkMgr *network.Manager, transferMgr *transfer.Manager, chatMgr *chat.Manager) *Manager {
+func New(fyneApp fyne.App, cfg *config.Config, identityMgr *identity.Manager, networkMgr *network.Manager, transferMgr *transfer.Manager, chatMgr *chat.Manager) *Manager {
 	manager := &Manager{
 		app:      fyneApp,
+		config:   cfg,
 		identity: identityMgr,
 		network:  networkMgr,
 		transfer: transferMgr,
@@ -258,6 +268,10 @@ func (m *Manager) createPeersTab() *fyne.Container {
 				container.NewHBox(
 					widget.NewButton("Chat", nil),
 					widget.NewButton("Send File", nil),
+					widget.NewButton("Details", nil),
+					widget.NewButton("☆", nil),
+					widget.NewButton("Block", nil),
+					widget.NewButton("Forget", nil),
 				),
 				container.NewVBox(
 					widget.NewLabel("Peer Name"),
@@ -268,7 +282,7 @@ func (m *Manager) createPeersTab() *fyne.Container {
 		func(item binding.DataItem, obj fyne.CanvasObject) {
 			text, _ := item.(binding.String).Get()
 			parts := strings.Split(text, "|")
-			if len(parts) >= 2 {
+			if len(parts) >= 4 {
 				cont := obj.(*fyne.Container)
 				vbox := cont.Objects[0].(*fyne.Container)
 				hbox := cont.Objects[1].(*fyne.Container)
@@ -277,10 +291,47 @@ func (m *Manager) createPeersTab() *fyne.Container {
 				idLabel := vbox.Objects[1].(*widget.Label)
 				chatBtn := hbox.Objects[0].(*widget.Button)
 				sendFileBtn := hbox.Objects[1].(*widget.Button)
+				detailsBtn := hbox.Objects[2].(*widget.Button)
+				favoriteBtn := hbox.Objects[3].(*widget.Button)
+				blockBtn := hbox.Objects[4].(*widget.Button)
+				forgetBtn := hbox.Objects[5].(*widget.Button)
 
 				nameLabel.SetText(parts[0])
 				idLabel.SetText(parts[1])
 
+				// Workspace headers group the peers below them
+				if parts[2] == "header" {
+					nameLabel.TextStyle = fyne.TextStyle{Bold: true}
+					nameLabel.Refresh()
+					idLabel.Hide()
+					hbox.Hide()
+					return
+				}
+				nameLabel.TextStyle = fyne.TextStyle{}
+				nameLabel.Refresh()
+				idLabel.Show()
+				hbox.Show()
+
+				// Offline known peers can be favorited, blocked or forgotten
+				online := parts[2] == "online"
+				favorite := parts[3] == "favorite"
+				if online {
+					chatBtn.Enable()
+					sendFileBtn.Enable()
+					detailsBtn.Enable()
+					forgetBtn.Hide()
+				} else {
+					chatBtn.Disable()
+					sendFileBtn.Disable()
+					detailsBtn.Disable()
+					forgetBtn.Show()
+				}
+				if favorite {
+					favoriteBtn.SetText("★")
+				} else {
+					favoriteBtn.SetText("☆")
+				}
+
 				// Set button callbacks
 				chatBtn.OnTapped = func() {
 					m.startChatWithPeer(parts[1])
@@ -288,6 +339,18 @@ func (m *Manager) createPeersTab() *fyne.Container {
 				sendFileBtn.OnTapped = func() {
 					m.sendFileToProj(parts[1])
 				}
+				detailsBtn.OnTapped = func() {
+					m.showPeerDetailsDialog(parts[1])
+				}
+				favoriteBtn.OnTapped = func() {
+					m.toggleFavorite(parts[1], !favorite)
+				}
+				blockBtn.OnTapped = func() {
+					m.blockPeer(parts[1], parts[0])
+				}
+				forgetBtn.OnTapped = func() {
+					m.forgetPeer(parts[1])
+				}
 			}
 		},
 	)
@@ -302,6 +365,16 @@ func (m *Manager) createPeersTab() *fyne.Container {
 		m.showConnectToPeerDialog()
 	})
 
+	// Add invite button for sharing a signed invite code
+	inviteBtn := widget.NewButton("Invite Peer", func() {
+		m.showCreateInviteDialog()
+	})
+
+	// Add access list button for blocked and allowed peers
+	accessBtn := widget.NewButton("Blocked & Allowed", func() {
+		m.showAccessDialog()
+	})
+
 	// Add peer count and connection info
 	peerCountLabel := widget.NewLabel("Peers: 0")
 	hostInfoLabel := widget.NewLabel(fmt.Sprintf("Host: %s", m.identity.GetPeerID().String()))
@@ -315,7 +388,7 @@ func (m *Manager) createPeersTab() *fyne.Container {
 	}()
 
 	// Create colored header
-	peersHeaderText := createColoredLabel("👥 Connected Peers", primaryColor)
+	peersHeaderText := createColoredLabel("👥 Peers", primaryColor)
 	peersHeaderText.TextStyle = fyne.TextStyle{Bold: true}
 	
 	return container.NewVBox(
@@ -325,7 +398,7 @@ func (m *Manager) createPeersTab() *fyne.Container {
 		widget.NewSeparator(),
 		m.peersList,
 		widget.NewSeparator(),
-		container.NewHBox(refreshBtn, connectBtn),
+		container.NewHBox(refreshBtn, connectBtn, inviteBtn, accessBtn),
 	)
 }
 
@@ -552,16 +625,22 @@ func (m *Manager) createStatusBar() *fyne.Container {
 	m.statusLabel.TextStyle = fyne.TextStyle{Bold: true}
 	
 	// Create colored status indicators
-	statusText := createStatusLabel("Ready", "success")
-	peersText := createColoredLabel("Peers: 0", infoColor)
-	transfersText := createColoredLabel("Transfers: 0", infoColor)
+	m.statusText = createStatusLabel("Ready", "success")
+	m.peersText = createColoredLabel("Peers: 0", infoColor)
+	m.transfersText = createColoredLabel("Transfers: 0", infoColor)
+	m.reachText = createStatusLabel("🌐 Reachability: unknown", "")
+	m.trafficText = createColoredLabel("↓ 0 B/s ↑ 0 B/s", infoColor)
 	
 	return container.NewHBox(
-		statusText,
+		m.statusText,
 		widget.NewSeparator(),
-		peersText,
+		m.peersText,
 		widget.NewSeparator(),
-		transfersText,
+		m.transfersText,
+		widget.NewSeparator(),
+		m.reachText,
+		widget.NewSeparator(),
+		m.trafficText,
 	)
 }
 
@@ -576,6 +655,13 @@ func (m *Manager) setupMenu() {
 			m.showDownloadFolderDialog()
 		}),
 		fyne.NewMenuItemSeparator(),
+		fyne.NewMenuItem("Create Share Link", func() {
+			m.showCreateShareDialog()
+		}),
+		fyne.NewMenuItem("Active Shares", func() {
+			m.showSharesDialog()
+		}),
+		fyne.NewMenuItemSeparator(),
 		fyne.NewMenuItem("Exit", func() {
 			m.app.Quit()
 		}),
@@ -592,6 +678,16 @@ func (m *Manager) setupMenu() {
 		fyne.NewMenuItem("Import Identity", func() {
 			m.showImportIdentityDialog()
 		}),
+		fyne.NewMenuItemSeparator(),
+		fyne.NewMenuItem("Received File Attributes", func() {
+			m.showMetadataSettingsDialog()
+		}),
+		fyne.NewMenuItem("Connection Access", func() {
+			m.showAccessDialog()
+		}),
+		fyne.NewMenuItem("Network Mode", func() {
+			m.showNetworkModeDialog()
+		}),
 	)
 
 	// Help menu
@@ -629,6 +725,15 @@ func (m *Manager) setupEventHandlers() {
 	m.transfer.SetTransferOfferHandler(func(transfer *transfer.Transfer) bool {
 		return m.showTransferOfferDialog(transfer)
 	})
+
+	m.transfer.SetShareDeniedHandler(func(token, reason string) {
+		m.showError("Share link refused", fmt.Errorf("the sharing peer refused the link: %s", reason))
+	})
+
+	// Network event handlers
+	m.network.SetContactRequestHandler(func(info peer.AddrInfo) {
+		m.showContactRequestDialog(info)
+	})
 }
 
 // refreshLoop periodically refreshes the UI
@@ -644,10 +749,70 @@ func (m *Manager) refreshLoop() {
 // refreshPeers refreshes the peers list
 func (m *Manager) refreshPeers() {
 	peers := m.network.GetPeers()
+	knownPeers := m.network.GetKnownPeers()
 	var peerStrings []string
 
+	favorites := make(map[peer.ID]string)
+	for _, known := range knownPeers {
+		if known.Favorite {
+			favorites[known.ID] = "favorite"
+		}
+	}
+
+	connected := make(map[peer.ID]bool)
+	rows := make(map[string][]string) // connected peer rows by workspace, "" for peers sharing none
 	for _, peer := range peers {
-		peerString := fmt.Sprintf("%s|%s", peer.Nickname, peer.ID)
+		info, exists := m.network.GetPeerInfo(peer.PeerID)
+		if !exists {
+			continue
+		}
+		connected[peer.PeerID] = true
+		name := info.Nickname
+		if info.Flagged {
+			name = fmt.Sprintf("⚠️ %s (%s)", info.Nickname, info.FlagReason)
+		}
+		if info.Version != "" {
+			name = fmt.Sprintf("%s · %s", name, info.Version)
+		}
+		if info.LatestRTT() > 0 {
+			name = fmt.Sprintf("%s · %s · %s", name, info.ConnType, formatRTT(info.LatestRTT()))
+		}
+		peerString := fmt.Sprintf("%s|%s|online|%s", name, info.ID, favorites[info.PeerID])
+
+		// A peer shows up under every workspace we share with it
+		if len(info.Workspaces) == 0 {
+			rows[""] = append(rows[""], peerString)
+		}
+		for _, workspace := range info.Workspaces {
+			rows[workspace] = append(rows[workspace], peerString)
+		}
+	}
+
+	workspaces := m.network.Workspaces()
+	if len(workspaces) == 0 {
+		peerStrings = append(peerStrings, rows[""]...)
+	} else {
+		for _, workspace := range workspaces {
+			peerStrings = append(peerStrings, fmt.Sprintf("📁 %s (%d)||header|", workspace, len(rows[workspace])))
+			peerStrings = append(peerStrings, rows[workspace]...)
+		}
+		if len(rows[""]) > 0 {
+			peerStrings = append(peerStrings, fmt.Sprintf("Other peers (%d)||header|", len(rows[""])))
+			peerStrings = append(peerStrings, rows[""]...)
+		}
+	}
+
+	// Known peers that are offline follow the connected ones
+	for _, known := range knownPeers {
+		if connected[known.ID] {
+			continue
+		}
+		name := known.Nickname
+		if name == "" {
+			name = known.ID.String()[:8]
+		}
+		name = fmt.Sprintf("⚫ %s (offline, last seen %s)", name, known.LastSeen.Format("Jan 2 15:04"))
+		peerString := fmt.Sprintf("%s|%s|offline|%s", name, known.ID, favorites[known.ID])
 		peerStrings = append(peerStrings, peerString)
 	}
 
@@ -730,6 +895,29 @@ func (m *Manager) updateStatusCounts() {
 
 	status := fmt.Sprintf("Peers: %d | Transfers: %d", peerCount, transferCount)
 	m.statusLabel.SetText(status)
+
+	m.peersText.Text = fmt.Sprintf("Peers: %d", peerCount)
+	m.peersText.Refresh()
+	m.transfersText.Text = fmt.Sprintf("Transfers: %d", transferCount)
+	m.transfersText.Refresh()
+
+	// Public and relayed peers can be reached from the internet, private ones only on the LAN
+	reachability := m.network.Reachability()
+	switch reachability {
+	case network.ReachabilityPublic, network.ReachabilityRelayed:
+		m.reachText.Color = successColor
+	case network.ReachabilityPrivate:
+		m.reachText.Color = warningColor
+	default:
+		m.reachText.Color = theme.ForegroundColor()
+	}
+	m.reachText.Text = fmt.Sprintf("🌐 Reachability: %s", reachability)
+	m.reachText.Refresh()
+
+	stats := m.network.Stats()
+	m.trafficText.Text = fmt.Sprintf("↓ %s/s ↑ %s/s (%s / %s total)",
+		formatBytes(int64(stats.RateIn)), formatBytes(int64(stats.RateOut)), formatBytes(stats.TotalIn), formatBytes(stats.TotalOut))
+	m.trafficText.Refresh()
 }
 
 // startChatWithPeer starts a chat with a peer
@@ -778,9 +966,17 @@ func (m *Manager) connectToPeerManually(addrStr string) {
 		return
 	}
 
+	// Connecting by hand approves the peer when unknown peers need approval
+	if m.network.AccessMode() == network.AccessAsk {
+		if err := m.network.Allow(peerInfo.ID.String()); err != nil {
+			m.showError("Failed to allow peer", err)
+			return
+		}
+	}
+
 	// Attempt connection
 	go func() {
-		if err := m.network.GetHost().Connect(context.Background(), *peerInfo); err != nil {
+		if err := m.network.Connect(context.Background(), *peerInfo); err != nil {
 			m.showError("Connection failed", fmt.Errorf("failed to connect to peer: %w", err))
 		} else {
 			// Connection successful - peer should appear in the list automatically
@@ -872,24 +1068,581 @@ func (m *Manager) showImportIdentityDialog() {
 	// TODO: Implement identity import dialog
 }
 
+// showMetadataSettingsDialog lets the user choose which offered file attributes are applied
+func (m *Manager) showMetadataSettingsDialog() {
+	policy := m.transfer.GetMetadataPolicy()
+
+	modTimeCheck := widget.NewCheck("Keep modification time", nil)
+	modTimeCheck.SetChecked(policy.ModTime)
+	permissionsCheck := widget.NewCheck("Keep read/write permissions", nil)
+	permissionsCheck.SetChecked(policy.Permissions)
+	executableCheck := widget.NewCheck("Keep executable bit", nil)
+	executableCheck.SetChecked(policy.Executable)
+
+	dialog.ShowForm("Received File Attributes", "Save", "Cancel", []*widget.FormItem{
+		widget.NewFormItem("", modTimeCheck),
+		widget.NewFormItem("", permissionsCheck),
+		widget.NewFormItem("", executableCheck),
+	}, func(accepted bool) {
+		if !accepted {
+			return
+		}
+
+		policy := config.MetadataPolicy{
+			ModTime:     modTimeCheck.Checked,
+			Permissions: permissionsCheck.Checked,
+			Executable:  executableCheck.Checked,
+		}
+		m.transfer.SetMetadataPolicy(policy)
+		m.config.Transfer.Metadata = policy
+		if err := m.config.Save(); err != nil {
+			m.showError("Failed to save settings", err)
+		}
+	}, m.window)
+}
+
+// showNetworkModeDialog lets the user choose how peers are discovered
+func (m *Manager) showNetworkModeDialog() {
+	modes := map[string]string{
+		"LAN only (local network, offline)": network.ModeLAN,
+		"Internet (local network and DHT)":  network.ModeInternet,
+		"Manual (no discovery)":             network.ModeManual,
+	}
+	modeNames := []string{"LAN only (local network, offline)", "Internet (local network and DHT)", "Manual (no discovery)"}
+	modeRadio := widget.NewRadioGroup(modeNames, nil)
+	for name, mode := range modes {
+		if mode == m.network.NetworkMode() {
+			modeRadio.SetSelected(name)
+		}
+	}
+
+	helpText := widget.NewLabel("LAN only mode applies right away and closes connections beyond the local network. If Shario started without the internet mode, NAT port mapping and relays start after a restart.")
+	helpText.Wrapping = fyne.TextWrapWord
+
+	dialog.ShowForm("Network Mode", "Save", "Cancel", []*widget.FormItem{
+		widget.NewFormItem("", modeRadio),
+		widget.NewFormItem("", helpText),
+	}, func(accepted bool) {
+		if !accepted || modeRadio.Selected == "" {
+			return
+		}
+
+		// NAT traversal for the internet mode waits for the next start, discovery switches now
+		mode := modes[modeRadio.Selected]
+		modeErr := m.network.SetNetworkMode(mode)
+		if modeErr != nil && !errors.Is(modeErr, network.ErrRestartRequired) {
+			m.showError("Failed to change network mode", modeErr)
+			return
+		}
+		m.config.Network.Mode = mode
+		if err := m.config.Save(); err != nil {
+			m.showError("Failed to save settings", err)
+			return
+		}
+		if modeErr != nil {
+			dialog.ShowInformation("Restart Required", "Discovery switched to the internet mode. Restart Shario to start port mapping, hole punching and relays.", m.window)
+		}
+	}, m.window)
+}
+
 // showConnectToPeerDialog shows manual peer connection dialog
 func (m *Manager) showConnectToPeerDialog() {
 	peerAddrEntry := widget.NewEntry()
 	peerAddrEntry.SetPlaceHolder("/ip4/192.168.1.100/tcp/12345/p2p/QmYWdN8PKoFFNFBNCeM6VsDrzzs1QQacLsmWAx3WLHTtGR")
 	peerAddrEntry.MultiLine = true
 
-	helpText := widget.NewLabel("Enter a peer's multiaddress. You can get this from another Shario instance's console output.")
+	helpText := widget.NewLabel("Enter an invite code, a share link or a peer's multiaddress. Peers create invite codes with the Invite Peer button.")
+	helpText.Wrapping = fyne.TextWrapWord
 
 	dialog.ShowForm("Connect to Peer", "Connect", "Cancel", []*widget.FormItem{
 		widget.NewFormItem("Peer Address", peerAddrEntry),
 		widget.NewFormItem("Help", helpText),
 	}, func(accepted bool) {
-		if accepted && strings.TrimSpace(peerAddrEntry.Text) != "" {
-			m.connectToPeerManually(strings.TrimSpace(peerAddrEntry.Text))
+		text := strings.TrimSpace(peerAddrEntry.Text)
+		if !accepted || text == "" {
+			return
+		}
+		if strings.HasPrefix(text, network.InvitePrefix) {
+			m.acceptInvite(text)
+			return
+		}
+		if strings.HasPrefix(text, transfer.ShareLinkPrefix) {
+			m.redeemShareLink(text)
+			return
+		}
+		m.connectToPeerManually(text)
+	}, m.window)
+}
+
+// acceptInvite validates an invite code and connects to the peer behind it
+func (m *Manager) acceptInvite(code string) {
+	// Validate before dialing so a bad code fails right away
+	if _, err := network.ParseInvite(code); err != nil {
+		m.showError("Invalid invite code", err)
+		return
+	}
+
+	go func() {
+		invite, err := m.network.AcceptInvite(context.Background(), code)
+		if err != nil {
+			m.showError("Connection failed", fmt.Errorf("failed to connect to invited peer: %w", err))
+			return
+		}
+
+		message := "Successfully connected to peer!"
+		if invite.Workspace != "" {
+			message = fmt.Sprintf("Successfully connected to peer! The invite is for workspace %s.", invite.Workspace)
+		}
+		dialog.ShowInformation("Success", message, m.window)
+	}()
+}
+
+// showCreateInviteDialog creates a signed invite code for connecting to us
+func (m *Manager) showCreateInviteDialog() {
+	expiries := map[string]time.Duration{
+		"1 hour":   time.Hour,
+		"24 hours": 24 * time.Hour,
+		"7 days":   7 * 24 * time.Hour,
+		"Never":    0,
+	}
+	expirySelect := widget.NewSelect([]string{"1 hour", "24 hours", "7 days", "Never"}, nil)
+	expirySelect.SetSelected("24 hours")
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("Expires after", expirySelect),
+	}
+
+	noWorkspace := "None"
+	workspaceSelect := widget.NewSelect(append([]string{noWorkspace}, m.network.Workspaces()...), nil)
+	workspaceSelect.SetSelected(noWorkspace)
+	if len(m.network.Workspaces()) > 0 {
+		items = append(items, widget.NewFormItem("Workspace", workspaceSelect))
+	}
+
+	dialog.ShowForm("Invite Peer", "Create", "Cancel", items, func(accepted bool) {
+		if !accepted {
+			return
+		}
+
+		workspace := workspaceSelect.Selected
+		if workspace == noWorkspace {
+			workspace = ""
+		}
+
+		invite, err := m.network.CreateInvite(workspace, expiries[expirySelect.Selected])
+		if err != nil {
+			m.showError("Failed to create invite", err)
+			return
+		}
+		m.showInviteDialog(invite.String())
+	}, m.window)
+}
+
+// showInviteDialog displays an invite code as text and as a QR code
+func (m *Manager) showInviteDialog(code string) {
+	codeEntry := widget.NewEntry()
+	codeEntry.SetText(code)
+	codeEntry.MultiLine = true
+	codeEntry.Wrapping = fyne.TextWrapBreak
+
+	copyBtn := widget.NewButton("Copy", func() {
+		m.window.Clipboard().SetContent(code)
+	})
+
+	content := container.NewVBox(
+		widget.NewLabel("Share this code with the peer, who pastes it into Connect to Peer:"),
+		codeEntry,
+		copyBtn,
+	)
+
+	// Codes with many addresses can exceed what a QR code holds, the text still works
+	if qr, err := qrcode.New(code, qrcode.Low); err == nil {
+		qrImage := canvas.NewImageFromImage(qr.Image(512))
+		qrImage.FillMode = canvas.ImageFillContain
+		qrImage.SetMinSize(fyne.NewSize(300, 300))
+		content.Add(qrImage)
+	}
+
+	inviteDialog := dialog.NewCustom("Invite Code", "Close", content, m.window)
+	inviteDialog.Resize(fyne.NewSize(500, 550))
+	inviteDialog.Show()
+}
+
+// redeemShareLink requests the file behind a share link
+func (m *Manager) redeemShareLink(link string) {
+	go func() {
+		if err := m.transfer.RedeemShareLink(link); err != nil {
+			m.showError("Failed to redeem share link", err)
+		} else {
+			dialog.ShowInformation("Share Link", "Requested the shared file. It will appear in the Transfers tab.", m.window)
+		}
+	}()
+}
+
+// showCreateShareDialog publishes a file under a new one-time share link
+func (m *Manager) showCreateShareDialog() {
+	expiries := map[string]time.Duration{
+		"1 hour":   time.Hour,
+		"24 hours": 24 * time.Hour,
+		"7 days":   7 * 24 * time.Hour,
+		"Never":    0,
+	}
+	expirySelect := widget.NewSelect([]string{"1 hour", "24 hours", "7 days", "Never"}, nil)
+	expirySelect.SetSelected("24 hours")
+
+	dialog.ShowForm("Create Share Link", "Choose File", "Cancel", []*widget.FormItem{
+		widget.NewFormItem("Expires after", expirySelect),
+	}, func(accepted bool) {
+		if !accepted {
+			return
+		}
+
+		dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil {
+				m.showError("Failed to open file", err)
+				return
+			}
+			if reader == nil {
+				return
+			}
+			defer reader.Close()
+
+			_, link, err := m.transfer.CreateShare(reader.URI().Path(), expiries[expirySelect.Selected])
+			if err != nil {
+				m.showError("Failed to create share link", err)
+				return
+			}
+			m.showShareLinkDialog(link.String())
+		}, m.window).Show()
+	}, m.window)
+}
+
+// showShareLinkDialog displays a share link ready to be copied
+func (m *Manager) showShareLinkDialog(link string) {
+	linkEntry := widget.NewEntry()
+	linkEntry.SetText(link)
+	linkEntry.MultiLine = true
+	linkEntry.Wrapping = fyne.TextWrapBreak
+
+	copyBtn := widget.NewButton("Copy", func() {
+		m.window.Clipboard().SetContent(link)
+	})
+
+	content := container.NewBorder(
+		widget.NewLabel("Anyone with this link can download the file once.\nShare links are kept in memory and stop working when Shario exits:"),
+		copyBtn, nil, nil,
+		linkEntry,
+	)
+
+	linkDialog := dialog.NewCustom("Share Link", "Close", content, m.window)
+	linkDialog.Resize(fyne.NewSize(500, 250))
+	linkDialog.Show()
+}
+
+// showSharesDialog lists the share links created in this session
+func (m *Manager) showSharesDialog() {
+	shares := m.transfer.GetShares()
+	if len(shares) == 0 {
+		dialog.ShowInformation("Active Shares", "No share links have been created.", m.window)
+		return
+	}
+
+	var sharesDialog dialog.Dialog
+	rows := container.NewVBox()
+	for _, share := range shares {
+		share := share
+		state := "active"
+		switch {
+		case share.Redeemed:
+			state = fmt.Sprintf("redeemed by %s", share.RedeemedBy.String()[:8])
+		case share.Revoked:
+			state = "revoked"
+		case share.Sending():
+			state = "sending"
+		case !share.Active():
+			state = "expired"
+		}
+
+		revokeBtn := widget.NewButton("Revoke", func() {
+			if err := m.transfer.RevokeShare(share.Token); err != nil {
+				m.showError("Failed to revoke share", err)
+			}
+			sharesDialog.Hide()
+			m.showSharesDialog()
+		})
+		if !share.Active() {
+			revokeBtn.Disable()
+		}
+
+		rows.Add(container.NewBorder(nil, nil, nil, revokeBtn,
+			widget.NewLabel(fmt.Sprintf("%s (%s)", share.Filename, state)),
+		))
+	}
+
+	sharesDialog = dialog.NewCustom("Active Shares", "Close", container.NewVScroll(rows), m.window)
+	sharesDialog.Resize(fyne.NewSize(500, 300))
+	sharesDialog.Show()
+}
+
+// showPeerDetailsDialog shows a connected peer's profile, connection type, latency and traffic
+func (m *Manager) showPeerDetailsDialog(peerIDStr string) {
+	peerID, err := peer.Decode(peerIDStr)
+	if err != nil {
+		m.showError("Invalid peer ID", err)
+		return
+	}
+
+	info, exists := m.network.GetPeerInfo(peerID)
+	if !exists {
+		dialog.ShowInformation("Peer Details", "The peer is no longer connected.", m.window)
+		return
+	}
+
+	version := info.Version
+	if version == "" {
+		version = "unknown"
+	}
+
+	connection := "unknown"
+	if info.ConnType != "" {
+		connection = fmt.Sprintf("%s over %s", info.ConnType, info.Transport)
+	}
+
+	latency := "not measured yet"
+	history := "-"
+	if len(info.RTTs) > 0 {
+		minRTT, maxRTT := info.RTTs[0], info.RTTs[0]
+		samples := make([]string, 0, len(info.RTTs))
+		for _, rtt := range info.RTTs {
+			if rtt < minRTT {
+				minRTT = rtt
+			}
+			if rtt > maxRTT {
+				maxRTT = rtt
+			}
+			samples = append(samples, formatRTT(rtt))
+		}
+		latency = fmt.Sprintf("%s (avg %s, min %s, max %s)",
+			formatRTT(info.LatestRTT()), formatRTT(info.AverageRTT()), formatRTT(minRTT), formatRTT(maxRTT))
+		history = strings.Join(samples, ", ")
+	}
+
+	capabilities := "none announced"
+	if len(info.Capabilities) > 0 {
+		capabilities = strings.Join(info.Capabilities, ", ")
+	}
+
+	idLabel := widget.NewLabel(info.ID)
+	idLabel.Wrapping = fyne.TextWrapBreak
+	historyLabel := widget.NewLabel(history)
+	historyLabel.Wrapping = fyne.TextWrapWord
+
+	form := widget.NewForm(
+		widget.NewFormItem("Nickname", widget.NewLabel(info.Nickname)),
+		widget.NewFormItem("Peer ID", idLabel),
+		widget.NewFormItem("Version", widget.NewLabel(version)),
+		widget.NewFormItem("Connection", widget.NewLabel(connection)),
+		widget.NewFormItem("Latency", widget.NewLabel(latency)),
+		widget.NewFormItem("Recent pings", historyLabel),
+		widget.NewFormItem("Traffic", widget.NewLabel(fmt.Sprintf("%s received, %s sent", formatBytes(info.BytesIn), formatBytes(info.BytesOut)))),
+		widget.NewFormItem("Connected since", widget.NewLabel(info.ConnectedAt.Format("Jan 2 15:04:05"))),
+		widget.NewFormItem("Capabilities", widget.NewLabel(capabilities)),
+	)
+
+	detailsDialog := dialog.NewCustom("Peer Details", "Close", form, m.window)
+	detailsDialog.Resize(fyne.NewSize(550, 400))
+	detailsDialog.Show()
+}
+
+// formatRTT formats a round trip time in milliseconds
+func formatRTT(rtt time.Duration) string {
+	return fmt.Sprintf("%.1f ms", float64(rtt)/float64(time.Millisecond))
+}
+
+// formatBytes formats a byte count with a binary unit
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for value := n / unit; value >= unit; value /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// toggleFavorite marks or unmarks a known peer as favorite
+func (m *Manager) toggleFavorite(peerIDStr string, favorite bool) {
+	peerID, err := peer.Decode(peerIDStr)
+	if err != nil {
+		m.showError("Invalid peer ID", err)
+		return
+	}
+
+	if err := m.network.SetFavorite(peerID, favorite); err != nil {
+		m.showError("Failed to update favorite", err)
+		return
+	}
+	m.refreshPeers()
+}
+
+// forgetPeer removes an offline peer from the address book
+func (m *Manager) forgetPeer(peerIDStr string) {
+	peerID, err := peer.Decode(peerIDStr)
+	if err != nil {
+		m.showError("Invalid peer ID", err)
+		return
+	}
+
+	if err := m.network.ForgetPeer(peerID); err != nil {
+		m.showError("Failed to forget peer", err)
+		return
+	}
+	m.refreshPeers()
+}
+
+// blockPeer asks for confirmation, then blocks a peer and disconnects it
+func (m *Manager) blockPeer(peerIDStr, name string) {
+	dialog.ShowConfirm("Block Peer", fmt.Sprintf("Block %s?\n\nThe peer is disconnected and cannot connect again until you unblock it.", name), func(confirmed bool) {
+		if !confirmed {
+			return
 		}
+		if err := m.network.Block(peerIDStr); err != nil {
+			m.showError("Failed to block peer", err)
+			return
+		}
+		m.refreshPeers()
 	}, m.window)
 }
 
+// showAccessDialog shows the access mode with the allowlist and blocklist
+func (m *Manager) showAccessDialog() {
+	var accessDialog dialog.Dialog
+	reopen := func() {
+		accessDialog.Hide()
+		m.showAccessDialog()
+	}
+
+	modes := map[string]string{
+		"Open (everyone except blocked peers)": network.AccessOpen,
+		"Allowlist only":                       network.AccessAllowlist,
+		"Ask on first contact":                 network.AccessAsk,
+	}
+	modeNames := []string{"Open (everyone except blocked peers)", "Allowlist only", "Ask on first contact"}
+	modeSelect := widget.NewSelect(modeNames, nil)
+	for name, mode := range modes {
+		if mode == m.network.AccessMode() {
+			modeSelect.SetSelected(name)
+		}
+	}
+	modeSelect.OnChanged = func(name string) {
+		if err := m.network.SetAccessMode(modes[name]); err != nil {
+			m.showError("Failed to change access mode", err)
+			return
+		}
+		m.config.Network.AccessMode = modes[name]
+		if err := m.config.Save(); err != nil {
+			m.showError("Failed to save settings", err)
+		}
+	}
+
+	entry := widget.NewEntry()
+	entry.SetPlaceHolder("Peer ID, IP address or CIDR network")
+	allowBtn := widget.NewButton("Allow", func() {
+		if err := m.network.Allow(entry.Text); err != nil {
+			m.showError("Failed to allow", err)
+			return
+		}
+		reopen()
+	})
+	blockBtn := widget.NewButton("Block", func() {
+		if err := m.network.Block(entry.Text); err != nil {
+			m.showError("Failed to block", err)
+			return
+		}
+		reopen()
+	})
+
+	rows := container.NewVBox(widget.NewLabelWithStyle("Blocked", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}))
+	for _, blocked := range m.network.BlockedEntries() {
+		blocked := blocked
+		rows.Add(container.NewBorder(nil, nil, nil,
+			widget.NewButton("Unblock", func() {
+				if err := m.network.Unblock(blocked); err != nil {
+					m.showError("Failed to unblock", err)
+				}
+				reopen()
+			}),
+			widget.NewLabel(blocked),
+		))
+	}
+
+	rows.Add(widget.NewLabelWithStyle("Allowed", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}))
+	for _, allowed := range m.network.AllowedEntries() {
+		allowed := allowed
+		rows.Add(container.NewBorder(nil, nil, nil,
+			widget.NewButton("Remove", func() {
+				if err := m.network.Disallow(allowed); err != nil {
+					m.showError("Failed to remove", err)
+				}
+				reopen()
+			}),
+			widget.NewLabel(allowed),
+		))
+	}
+
+	content := container.NewBorder(
+		container.NewVBox(
+			widget.NewForm(widget.NewFormItem("Access mode", modeSelect)),
+			container.NewBorder(nil, nil, nil, container.NewHBox(allowBtn, blockBtn), entry),
+			widget.NewSeparator(),
+		),
+		nil, nil, nil,
+		container.NewVScroll(rows),
+	)
+
+	accessDialog = dialog.NewCustom("Connection Access", "Close", content, m.window)
+	accessDialog.Resize(fyne.NewSize(600, 450))
+	accessDialog.Show()
+}
+
+// showContactRequestDialog asks whether an unknown peer may connect
+func (m *Manager) showContactRequestDialog(info peer.AddrInfo) {
+	content := widget.NewLabel(fmt.Sprintf("An unknown peer wants to connect:\n\n%s\n%v\n\nAllow it to connect now and in the future?", info.ID, info.Addrs))
+
+	var requestDialog *dialog.CustomDialog
+	allowBtn := widget.NewButton("Allow", func() {
+		requestDialog.Hide()
+		if err := m.network.Allow(info.ID.String()); err != nil {
+			m.showError("Failed to allow peer", err)
+			return
+		}
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), network.ConnectionTimeout)
+			defer cancel()
+			if err := m.network.Connect(ctx, info); err != nil {
+				m.showError("Connection failed", fmt.Errorf("failed to connect to peer: %w", err))
+			}
+		}()
+	})
+	allowBtn.Importance = widget.HighImportance
+	blockBtn := widget.NewButton("Block", func() {
+		requestDialog.Hide()
+		if err := m.network.Block(info.ID.String()); err != nil {
+			m.showError("Failed to block peer", err)
+		}
+	})
+	laterBtn := widget.NewButton("Not Now", func() {
+		requestDialog.Hide()
+	})
+
+	requestDialog = dialog.NewCustomWithoutButtons("Connection Request", content, m.window)
+	requestDialog.SetButtons([]fyne.CanvasObject{laterBtn, blockBtn, allowBtn})
+	requestDialog.Show()
+}
+
 // showAboutDialog shows the about dialog
 func (m *Manager) showAboutDialog() {
 	dialog.ShowInformation("About Shario",
@@ -967,8 +1720,13 @@ func (m *Manager) openFileInSystem(path string) error {
 func (m *Manager) showTransferOfferDialog(transfer *transfer.Transfer) bool {
 	fmt.Printf("🎯 UI: Showing transfer offer dialog for file: %s\n", transfer.Filename)
 
-	content := fmt.Sprintf("Peer %s wants to send you a file:\n\nFilename: %s\nSize: %d bytes\n\nDo you want to accept this transfer?",
-		transfer.PeerNickname, transfer.Filename, transfer.Size)
+	fileType := transfer.MIMEType
+	if fileType == "" {
+		fileType = "unknown"
+	}
+
+	content := fmt.Sprintf("Peer %s wants to send you a file:\n\nFilename: %s\nSize: %d bytes\nType: %s\nSigned by: %s\n\nDo you want to accept this transfer?",
+		transfer.PeerNickname, transfer.Filename, transfer.Size, fileType, transfer.Offer.SenderID)
 
 	// Use a channel to wait for user response
 	responseChan := make(chan bool, 1)
@@ -6,17 +6,52 @@
 package main
 
 import (
+	"flag"
 	"log"
+	"os"
+	"os/signal"
 	"shario/internal/app"
+	"shario/internal/config"
+	"syscall"
 )
 
 func main() {
+	flags := config.RegisterFlags()
+	inviteCode := flag.String("invite", "", "connect to the peer behind an invite code")
+	flag.Parse()
+
+	// Key tools run instead of the application
+	if ran, err := app.RunTools(flags); ran {
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// Initialize and run the Shario application
-	app, err := app.New()
+	app.Version = version
+	app, err := app.New(flags)
 	if err != nil {
 		log.Fatal("Failed to initialize application:", err)
 	}
 
+	// Connect to the peer behind an invite code passed on the command line
+	if *inviteCode != "" {
+		go func() {
+			if err := app.AcceptInvite(*inviteCode); err != nil {
+				log.Printf("Failed to accept invite: %v", err)
+			}
+		}()
+	}
+
+	// Quit the GUI on Ctrl+C or SIGTERM, so peers are told we are leaving
+	go func() {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+		<-c
+		app.Shutdown()
+	}()
+
 	// Start the application
 	if err := app.Run(); err != nil {
 		log.Fatal("Application error:", err)
@@ -5,15 +5,30 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"shario/internal/app"
+	"shario/internal/config"
 	"syscall"
 )
 
 func main() {
+	flags := config.RegisterFlags()
+	redeemLink := flag.String("redeem", "", "download the file behind a one-time share link")
+	inviteCode := flag.String("invite", "", "connect to the peer behind an invite code")
+	flag.Parse()
+
+	// Key tools run instead of the application
+	if ran, err := app.RunTools(flags); ran {
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	fmt.Println("Shario - P2P File Sharing (Headless Mode)")
 	fmt.Println("========================================")
 	fmt.Println("Running in headless mode - GUI not available on this platform")
@@ -21,7 +36,8 @@ func main() {
 	fmt.Println()
 
 	// Initialize the application without GUI
-	app, err := app.New()
+	app.Version = version
+	app, err := app.New(flags)
 	if err != nil {
 		log.Fatal("Failed to initialize application:", err)
 	}
@@ -31,10 +47,25 @@ func main() {
 		log.Fatal("Application error:", err)
 	}
 
+	// Redeem a share link passed on the command line
+	if *redeemLink != "" {
+		if err := app.RedeemShareLink(*redeemLink); err != nil {
+			log.Printf("Failed to redeem share link: %v", err)
+		}
+	}
+
+	// Connect to the peer behind an invite code passed on the command line
+	if *inviteCode != "" {
+		if err := app.AcceptInvite(*inviteCode); err != nil {
+			log.Printf("Failed to accept invite: %v", err)
+		}
+	}
+
 	// Wait for interrupt signal
 	fmt.Println("Shario is running in headless mode. Press Ctrl+C to stop.")
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	<-c
 	fmt.Println("\nShutting down...")
+	app.Shutdown()
 }
\ No newline at end of file
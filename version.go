@@ -0,0 +1,4 @@
+package main
+
+// version is set at build time with -ldflags "-X main.version=..."
+var version = "dev"